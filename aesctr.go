@@ -0,0 +1,91 @@
+package sampler
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+)
+
+// AESCTRSeedSize is the length of the entropy input of the AES-256 CTR DRBG.
+const AESCTRSeedSize = 48
+
+// aesCTRDRBG is the AES-256 CTR_DRBG without derivation function of
+// NIST SP 800-90A, as implemented by rng.c of the NIST PQC test harness
+// with which the Falcon KATs were generated.
+type aesCTRDRBG struct {
+	block cipher.Block // AES-256 under the current key
+	v     [aes.BlockSize]byte
+}
+
+// newAESCTRDRBG returns the DRBG instantiated as randombytes_init(seed, NULL)
+// of the harness: an update of the all-zero key and counter with seed. It
+// panics unless seed is AESCTRSeedSize bytes long.
+func newAESCTRDRBG(seed []byte) *aesCTRDRBG {
+	if len(seed) != AESCTRSeedSize {
+		panic(fmt.Sprintf("sampler: AES-CTR DRBG seed of %d bytes, want %d", len(seed), AESCTRSeedSize))
+	}
+	d := new(aesCTRDRBG)
+	d.block = newAES256(make([]byte, 32))
+	d.update(seed)
+	return d
+}
+
+func newAES256(key []byte) cipher.Block {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return block
+}
+
+// next increments the big-endian counter and encrypts it into dst.
+func (d *aesCTRDRBG) next(dst []byte) {
+	for i := len(d.v) - 1; i >= 0; i-- {
+		d.v[i]++
+		if d.v[i] != 0 {
+			break
+		}
+	}
+	d.block.Encrypt(dst, d.v[:])
+}
+
+// update is AES256_CTR_DRBG_Update of the harness: the key and the counter
+// are replaced with the next three blocks of keystream, xored with provided
+// when it is not nil.
+func (d *aesCTRDRBG) update(provided []byte) {
+	var temp [AESCTRSeedSize]byte
+	for i := 0; i < len(temp); i += aes.BlockSize {
+		d.next(temp[i:])
+	}
+	for i := range provided {
+		temp[i] ^= provided[i]
+	}
+	d.block = newAES256(temp[:32])
+	copy(d.v[:], temp[32:])
+}
+
+// Read is randombytes(p, len(p)) of the harness. As there, each call ends
+// with an update, so the stream depends on how it is split into reads, and
+// not only on the seed.
+func (d *aesCTRDRBG) Read(p []byte) (int, error) {
+	var buf [aes.BlockSize]byte
+	for i := 0; i < len(p); i += aes.BlockSize {
+		d.next(buf[:])
+		copy(p[i:], buf[:])
+	}
+	d.update(nil)
+	return len(p), nil
+}
+
+// NewSamplerFromAESCTR returns a sampler drawing its randomness from the
+// AES-256 CTR DRBG of the NIST PQC test harness, instantiated with the
+// AESCTRSeedSize-byte entropy input seed, so that it reads the same stream
+// as the Falcon reference implementation under the KAT harness. It panics
+// unless seed is AESCTRSeedSize bytes long.
+//
+// Each read of the sampler is one call to the randombytes of the harness, so
+// the DRBG output matches the reference only for the same sequence of read
+// sizes; WithReadBuffer changes that sequence.
+func NewSamplerFromAESCTR(seed []byte) *Sampler {
+	return newsampler(newAESCTRDRBG(seed))
+}
@@ -0,0 +1,46 @@
+package sampler
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestAESCTRDRBG checks the DRBG against the first seeds drawn by
+// PQCgenKAT_sign, randombytes(seed, 48) after randombytes_init with the
+// entropy input 00 01 ... 2f, which appear as count = 0 and count = 1 of
+// every NIST PQC KAT file.
+func TestAESCTRDRBG(t *testing.T) {
+	entropy := make([]byte, AESCTRSeedSize)
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+	d := newAESCTRDRBG(entropy)
+	for count, want := range []string{
+		"061550234D158C5EC95595FE04EF7A25767F2E24CC2BC479D09D86DC9ABCFDE7056A8C266F9EF97ED08541DBD2E1FFA1",
+		"D81C4D8D734FCBFBEADE3D3F8A039FAA2A2C9957E835AD55B22E75BF57BB556AC81ADDE6AEEB4A5A875C3BFCADFA958F",
+	} {
+		got := make([]byte, 48)
+		d.Read(got)
+		if !bytes.Equal(got, decodeHexString(want)) {
+			t.Errorf("count = %d: got seed %X, want %s", count, got, want)
+		}
+	}
+}
+
+func TestNewSamplerFromAESCTR(t *testing.T) {
+	seed := bytes.Repeat([]byte{3}, AESCTRSeedSize)
+	sp := NewSamplerFromAESCTR(seed)
+	ref := newsampler(newAESCTRDRBG(seed))
+	for i := 0; i < 1000; i++ {
+		if z, want := sp.Samplerz(-0.5, 1.7, 1.28), ref.Samplerz(-0.5, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a 32-byte seed")
+		}
+	}()
+	NewSamplerFromAESCTR(seed[:32])
+}
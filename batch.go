@@ -0,0 +1,231 @@
+package sampler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// uniformFromBytes splits a big-endian draw of 8 to 16 bytes into its high and
+// low 64-bit words, matching the interpretation of baseSampler.
+func uniformFromBytes(b []byte) [2]uint64 {
+	n := len(b) - 8
+	var hi uint64
+	for _, c := range b[:n] {
+		hi = hi<<8 | uint64(c)
+	}
+	return [2]uint64{hi, binary.BigEndian.Uint64(b[n:])}
+}
+
+// errWideTable is returned by baseSamplerBatch for a table wider than 128
+// bits, whose uniforms do not fit in two words.
+var errWideTable = errors.New("sampler: batched base sampler needs a table of at most 128 bits")
+
+// baseSamplerBatch computes the base sampler output of sp for many uniforms
+// at once. Each uniform is given as {high word, low word} of the value drawn
+// by baseSampler, and out[i] receives the number of entries of the table of
+// sp strictly greater than uniforms[i], or greater than or equal with
+// WithBaseSamplerInclusive. It returns errWideTable if the precision of the
+// table, see WithTable, exceeds 128 bits.
+//
+// The comparison u < elt is the borrow of the 128-bit subtraction u - elt,
+// and elt < u that of elt - u, so the inner loop is branch-free and of fixed
+// length.
+func (sp *Sampler) baseSamplerBatch(uniforms [][2]uint64, out []int) error {
+	if len(sp.baseSamplerRB) > 16 {
+		return errWideTable
+	}
+	out = out[:len(uniforms)]
+	hi := make([]uint64, len(sp.rcdt))
+	lo := make([]uint64, len(sp.rcdt))
+	for j, elt := range sp.rcdt {
+		lo[j], hi[j] = elt[0], elt[1]
+	}
+	for i, u := range uniforms {
+		var z0 uint64
+		if sp.baseSamplerInclusive {
+			// u <= elt is the complement of elt < u.
+			for j := range lo {
+				_, b := bits.Sub64(lo[j], u[1], 0)
+				_, b = bits.Sub64(hi[j], u[0], b)
+				z0 += 1 - b
+			}
+		} else {
+			for j := range lo {
+				_, b := bits.Sub64(u[1], lo[j], 0)
+				_, b = bits.Sub64(u[0], hi[j], b)
+				z0 += b
+			}
+		}
+		out[i] = int(z0)
+	}
+	return nil
+}
+
+// approxexpLanes is the number of polynomials approxexpBatch evaluates in
+// lockstep.
+const approxexpLanes = 4
+
+// approxexpBatch sets out[i] to approxexp(xs[i], ccs) for every x. The
+// polynomial is evaluated on approxexpLanes values at a time, coefficient by
+// coefficient, so that the independent multiplications of the lanes overlap
+// instead of waiting on one another as in the scalar Horner chain.
+func (sp *Sampler) approxexpBatch(xs []float64, ccs float64, out []uint64) {
+	out = out[:len(xs)]
+	zccs := sp.fixedCCS(ccs)
+	shift := sp.expShift
+	i := 0
+	for ; i+approxexpLanes <= len(xs); i += approxexpLanes {
+		var z, y [approxexpLanes]uint64
+		for l := range z {
+			z[l] = uint64(xs[i+l] * sp.expScale)
+			y[l] = sp.expC[0]
+		}
+		for _, elt := range sp.expC[1:] {
+			for l := range y {
+				y[l] = elt - mulShift(z[l], y[l], shift)
+			}
+		}
+		for l := range y {
+			out[i+l] = mulShift(zccs, y[l], shift) << (63 - shift)
+		}
+	}
+	for ; i < len(xs); i++ {
+		out[i] = sp.approxexpFixed(uint64(xs[i]*sp.expScale), zccs)
+	}
+}
+
+// SamplerzBatch sets out[i] to Samplerz(mus[i], sigma, sigmin) for every
+// center, as needed to sample a whole polynomial when signing. The values
+// depending on sigma and sigmin are computed once for the batch, and no
+// sample allocates.
+//
+// The samples draw from the randomness source of sp in order, so they are
+// order-dependent: reordering the centers changes which part of the stream
+// each of them consumes, and not only the order of the samples. Use
+// SamplerzBatchIndexed for samples tied to their index.
+//
+// It panics if out is shorter than mus, or as Samplerz.
+func (sp *Sampler) SamplerzBatch(mus []float64, sigma, sigmin float64, out []int) {
+	if len(out) < len(mus) {
+		panic("sampler: SamplerzBatch output shorter than the centers")
+	}
+	p := sp.newSigmaParams(sigma, sigmin)
+	for i, mu := range mus {
+		z, _, err := sp.samplerzWith(context.Background(), mu, p)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = z
+	}
+}
+
+// SampleVec sets out[i] to Samplerz(mus[i], sigmas[i], sigmin), as for the
+// 2n coefficients of a Falcon signature, each with the sigma of its leaf of
+// the Falcon tree. The values depending on sigma are only recomputed when
+// sigmas[i] differs from sigmas[i-1], and the samples draw from the stream
+// of sp in order, as those of SamplerzBatch.
+//
+// SampleVec does not buffer reads itself: only with a read buffer (see
+// WithReadBuffer or NewSamplerFromSeed) is the source read in large blocks
+// across the vector, and otherwise every draw reads the source. A buffer of
+// its own would read ahead and leave bytes of the stream of sp behind.
+//
+// It panics if sigmas or out is shorter than mus, or as Samplerz.
+func (sp *Sampler) SampleVec(mus, sigmas []float64, sigmin float64, out []int) {
+	if len(sigmas) < len(mus) || len(out) < len(mus) {
+		panic("sampler: SampleVec sigmas or output shorter than the centers")
+	}
+	var p sigmaParams
+	for i, mu := range mus {
+		if i == 0 || sigmas[i] != sigmas[i-1] {
+			p = sp.newSigmaParams(sigmas[i], sigmin)
+		}
+		z, _, err := sp.samplerzWith(context.Background(), mu, p)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = z
+	}
+}
+
+// SamplerzInto16 is SamplerzBatch writing the samples as int16, as for the
+// coefficients of a Falcon polynomial, which always fit. It returns an error
+// wrapping ErrOverflow if a sample does not fit in an int16, which takes a
+// center near or beyond the bounds of int16, and otherwise the error of
+// SamplerzErr if any. On error, out holds the samples drawn before the
+// failing one.
+//
+// It panics if out is shorter than mus.
+func (sp *Sampler) SamplerzInto16(mus []float64, sigma, sigmin float64, out []int16) error {
+	if len(out) < len(mus) {
+		panic("sampler: SamplerzInto16 output shorter than the centers")
+	}
+	p := sp.newSigmaParams(sigma, sigmin)
+	for i, mu := range mus {
+		z, _, err := sp.samplerzWith(context.Background(), mu, p)
+		if err != nil {
+			return err
+		}
+		if z < math.MinInt16 || z > math.MaxInt16 {
+			return fmt.Errorf("%w: sample %d of center %d, mu = %v, beyond int16", ErrOverflow, z, i, mu)
+		}
+		out[i] = int16(z)
+	}
+	return nil
+}
+
+// SamplerzN returns n independent samples of the same D_{Z, mu, sigma}, each
+// a fresh draw of the rejection loop. The center is split and the values
+// depending on sigma and sigmin are computed once for all of them. The
+// samples are those of n successive calls to Samplerz(mu, sigma, sigmin).
+//
+// It panics as Samplerz.
+func (sp *Sampler) SamplerzN(mu, sigma, sigmin float64, n int) []int {
+	s, r, err := splitCenter(mu)
+	if err != nil {
+		panic(err)
+	}
+	p := sp.newSigmaParams(sigma, sigmin)
+	if err := p.checkFinite(); err != nil {
+		panic(err)
+	}
+	out := make([]int, n)
+	for i := range out {
+		z, _, err := sp.samplerzAt(context.Background(), mu, s, r, p)
+		if err != nil {
+			panic(err)
+		}
+		out[i] = z
+	}
+	return out
+}
+
+// indexedDomain separates the per-index streams of SamplerzBatchIndexed from
+// any other use of the seed.
+const indexedDomain = "FalconSampler/SamplerzBatchIndexed"
+
+// SamplerzBatchIndexed sets out[i] to a sample of center mus[i] drawn from a
+// SHAKE256 stream of its own, seeded with indexedDomain || uint64(i) || seed.
+// Unlike samples drawn in turn from one sampler, each of them depends only on
+// the seed, its index and its center, and not on the order in which the
+// indices are processed, so the batch can be split across goroutines and
+// still give reproducible output.
+//
+// It panics if out is shorter than mus, or as Samplerz.
+func SamplerzBatchIndexed(seed []byte, mus []float64, sigma, sigmin float64, out []int) {
+	if len(out) < len(mus) {
+		panic("sampler: SamplerzBatchIndexed output shorter than the centers")
+	}
+	for i, mu := range mus {
+		out[i] = samplerzAtIndex(seed, i, mu, sigma, sigmin)
+	}
+}
+
+// samplerzAtIndex returns the sample of index i of SamplerzBatchIndexed.
+func samplerzAtIndex(seed []byte, i int, mu, sigma, sigmin float64) int {
+	return newsampler(fromSeedSHAKE(domainSeed(indexedDomain, uint64(i), seed))).Samplerz(mu, sigma, sigmin)
+}
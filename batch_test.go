@@ -0,0 +1,378 @@
+package sampler
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// uniformBytes returns n draws of size bytes worth of SHAKE256 output.
+func uniformBytes(n, size int) []byte {
+	buf := make([]byte, n*size)
+	fromSeedSHAKE(testSeed).Read(buf)
+	return buf
+}
+
+func TestBaseSamplerBatch(t *testing.T) {
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		opts      []Option
+		precBytes int
+	}{
+		{"default", nil, int(RCDTprecLen)},
+		{"inclusive", []Option{WithBaseSamplerInclusive()}, int(RCDTprecLen)},
+		{"80-bit table", []Option{WithTable(table, 3, 80)}, 10},
+	} {
+		sp, err := NewSamplerWithOptions(nil, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := uniformBytes(4096, tc.precBytes)
+		// Draws exactly on and around each table entry exercise the boundaries.
+		for _, elt := range sp.rcdt {
+			for _, d := range []uint64{0, 1} {
+				var b [32]byte
+				u := *elt
+				u[0] -= d
+				u.WriteToArray32(&b)
+				buf = append(buf, b[32-tc.precBytes:]...)
+			}
+		}
+		n := len(buf) / tc.precBytes
+
+		uniforms := make([][2]uint64, n)
+		for i := range uniforms {
+			uniforms[i] = uniformFromBytes(buf[i*tc.precBytes : (i+1)*tc.precBytes])
+		}
+		out := make([]int, n)
+		if err := sp.baseSamplerBatch(uniforms, out); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		sp.SetReader(bytesReader(buf))
+		for i := range out {
+			if z0, _ := sp.baseSampler(); out[i] != z0 {
+				t.Fatalf("%s, draw %d: batch gives %d, baseSampler gives %d", tc.name, i, out[i], z0)
+			}
+		}
+	}
+
+	// Uniforms of more than 128 bits do not fit in two words.
+	sp, err := NewSamplerWithOptions(nil, WithRCDTPrecisionBytes(17))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.baseSamplerBatch(make([][2]uint64, 1), make([]int, 1)); !errors.Is(err, errWideTable) {
+		t.Errorf("136-bit table: got %v, want errWideTable", err)
+	}
+}
+
+const benchBatch = 1024
+
+func BenchmarkBaseSampler(b *testing.B) {
+	buf := uniformBytes(benchBatch, int(RCDTprecLen))
+	r := bytes.NewReader(buf)
+	sp := newsampler(r)
+	for i := 0; i < b.N; i++ {
+		r.Reset(buf)
+		for j := 0; j < benchBatch; j++ {
+			sp.baseSampler()
+		}
+	}
+}
+
+func BenchmarkBaseSamplerBatch(b *testing.B) {
+	buf := uniformBytes(benchBatch, int(RCDTprecLen))
+	sp := newsampler(nil)
+	uniforms := make([][2]uint64, benchBatch)
+	out := make([]int, benchBatch)
+	for i := 0; i < b.N; i++ {
+		for j := range uniforms {
+			uniforms[j] = uniformFromBytes(buf[j*int(RCDTprecLen) : (j+1)*int(RCDTprecLen)])
+		}
+		sp.baseSamplerBatch(uniforms, out)
+	}
+}
+
+// shuffledCenters returns n centers, a permutation of their indices and the
+// centers in the order of that permutation.
+func shuffledCenters(n int) (mus []float64, perm []int, shuffled []float64) {
+	mus = make([]float64, n)
+	for i := range mus {
+		mus[i] = float64(i)*3.7 - 100
+	}
+	perm = rand.New(rand.NewSource(1)).Perm(n)
+	shuffled = make([]float64, n)
+	for j, i := range perm {
+		shuffled[j] = mus[i]
+	}
+	return mus, perm, shuffled
+}
+
+func TestSamplerzBatchIndexed(t *testing.T) {
+	mus, perm, shuffled := shuffledCenters(64)
+
+	// Samples drawn in turn from one sampler depend on the order of the
+	// centers: the shuffled samples are not the permuted ones.
+	inTurn := func(mus []float64) []int {
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		out := make([]int, len(mus))
+		for i, mu := range mus {
+			out[i] = sp.Samplerz(mu, 1.7, 1.28)
+		}
+		return out
+	}
+	out, outShuffled := inTurn(mus), inTurn(shuffled)
+	permuted := true
+	for j, i := range perm {
+		permuted = permuted && outShuffled[j] == out[i]
+	}
+	if permuted {
+		t.Error("samples from a shared stream are expected to depend on the order of the centers")
+	}
+
+	// The indexed variant: each sample depends only on its index and center,
+	// whatever the processing order.
+	SamplerzBatchIndexed(testSeed, mus, 1.7, 1.28, out)
+	for _, i := range perm {
+		if want := samplerzAtIndex(testSeed, i, mus[i], 1.7, 1.28); out[i] != want {
+			t.Fatalf("index %d: got %d, want %d when processed alone", i, out[i], want)
+		}
+	}
+	SamplerzBatchIndexed(testSeed, shuffled, 1.7, 1.28, outShuffled)
+	for j, i := range perm {
+		if want := samplerzAtIndex(testSeed, j, mus[i], 1.7, 1.28); outShuffled[j] != want {
+			t.Fatalf("shuffled index %d: got %d, want %d", j, outShuffled[j], want)
+		}
+	}
+}
+
+func TestSamplerzBatch(t *testing.T) {
+	// The batch matches Samplerz in a loop over the same stream.
+	mus, _, _ := shuffledCenters(64)
+	out := make([]int, len(mus))
+	newsampler(fromSeedSHAKE(testSeed)).SamplerzBatch(mus, 1.7, 1.28, out)
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i, mu := range mus {
+		if want := ref.Samplerz(mu, 1.7, 1.28); out[i] != want {
+			t.Fatalf("sample %d: got %d, want %d", i, out[i], want)
+		}
+	}
+}
+
+func TestSamplerzN(t *testing.T) {
+	const mu, sigma, sigmin = -7.6, 1.7, 1.28
+	const n = 200000
+	out := newsampler(fromSeedSHAKE(testSeed)).SamplerzN(mu, sigma, sigmin, n)
+	if len(out) != n {
+		t.Fatalf("%d samples, want %d", len(out), n)
+	}
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		if want := ref.Samplerz(mu, sigma, sigmin); out[i] != want {
+			t.Fatalf("sample %d: got %d, want %d", i, out[i], want)
+		}
+	}
+
+	// Goodness of fit of the histogram against the PMF.
+	h := make(Histogram)
+	for _, z := range out {
+		h[z]++
+	}
+	lo, hi := gaussianWindow(mu, sigma)
+	var observed, expected []float64
+	for z := lo; z <= hi; z++ {
+		observed = append(observed, float64(h[z]))
+		expected = append(expected, n*DiscreteGaussianPMF(z, mu, sigma))
+	}
+	observed, expected = poolTails(observed, expected, selfTestMinExpected)
+	var chi2 float64
+	for i := range expected {
+		d := observed[i] - expected[i]
+		chi2 += d * d / expected[i]
+	}
+	if p := chiSquaredSF(chi2, len(expected)-1); p < SelfTestAlpha {
+		t.Errorf("chi-squared %v over %d bins: p-value %v", chi2, len(expected), p)
+	}
+
+	if out := newsampler(fromSeedSHAKE(testSeed)).SamplerzN(mu, sigma, sigmin, 0); len(out) != 0 {
+		t.Errorf("n = 0: got %v", out)
+	}
+}
+
+func TestSamplerzInto16(t *testing.T) {
+	mus := make([]float64, 512)
+	for i := range mus {
+		mus[i] = float64(i)*1.9 - 480
+	}
+	out := make([]int16, len(mus))
+	if err := newsampler(fromSeedSHAKE(testSeed)).SamplerzInto16(mus, 1.7, 1.28, out); err != nil {
+		t.Fatal(err)
+	}
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i, mu := range mus {
+		if want := ref.Samplerz(mu, 1.7, 1.28); int(out[i]) != want {
+			t.Fatalf("sample %d: got %d, want %d", i, out[i], want)
+		}
+	}
+
+	// At the center of a sample just within the bounds, a few draws land
+	// beyond them. Each such sample must be reported, not wrapped around.
+	for _, edge := range []float64{math.MaxInt16 + 0.5, math.MinInt16 - 0.5} {
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		var overflows int
+		for i := 0; i < 200; i++ {
+			out := []int16{0, 0}
+			err := sp.SamplerzInto16([]float64{3, edge}, 1.7, 1.28, out)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, ErrOverflow) {
+				t.Fatalf("center %v: got %v, want ErrOverflow", edge, err)
+			}
+			if out[1] != 0 {
+				t.Fatalf("center %v: overflowing sample written as %d", edge, out[1])
+			}
+			overflows++
+		}
+		if overflows < 50 || overflows > 150 {
+			t.Errorf("center %v: %d overflows in 200 samples", edge, overflows)
+		}
+	}
+	if err := newsampler(bytesReader(nil)).SamplerzInto16([]float64{1e6}, 1.7, 1.28, make([]int16, 1)); !errors.Is(err, ErrRNG) {
+		t.Errorf("empty source: got %v, want ErrRNG", err)
+	}
+}
+
+func TestSampleVec(t *testing.T) {
+	const n = 1024
+	rng := rand.New(rand.NewSource(1))
+	mus, sigmas := make([]float64, n), make([]float64, n)
+	for i := range mus {
+		mus[i] = rng.NormFloat64() * 100
+		sigmas[i] = 1.3 + 0.5*rng.Float64()
+		if i%4 != 0 {
+			sigmas[i] = sigmas[i-1] // runs of equal sigmas
+		}
+	}
+	out := make([]int, n)
+	NewSamplerFromSeed(testSeed).SampleVec(mus, sigmas, 1.28, out)
+	ref := NewSamplerFromSeed(testSeed)
+	for i := range mus {
+		if want := ref.Samplerz(mus[i], sigmas[i], 1.28); out[i] != want {
+			t.Fatalf("sample %d: got %d, want %d", i, out[i], want)
+		}
+	}
+
+	sp := NewSamplerFromSeed(testSeed)
+	if n := testing.AllocsPerRun(10, func() { sp.SampleVec(mus, sigmas, 1.28, out) }); n != 0 {
+		t.Errorf("SampleVec allocates %v times", n)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for sigmas shorter than the centers")
+		}
+	}()
+	sp.SampleVec(mus, sigmas[:n-1], 1.28, out)
+}
+
+func TestSamplerzBatchAllocs(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	mus := make([]float64, 512)
+	for i := range mus {
+		mus[i] = float64(i)*0.37 - 90
+	}
+	out := make([]int, len(mus))
+	if n := testing.AllocsPerRun(10, func() { sp.SamplerzBatch(mus, 1.7, 1.28, out) }); n != 0 {
+		t.Errorf("SamplerzBatch allocates %v times per batch, want 0", n)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("SamplerzBatch did not panic with a short output")
+		}
+	}()
+	sp.SamplerzBatch(mus, 1.7, 1.28, out[:511])
+}
+
+func BenchmarkSamplerzBatch(b *testing.B) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	mus := make([]float64, 512)
+	for i := range mus {
+		mus[i] = float64(i)*0.37 - 90
+	}
+	out := make([]int, len(mus))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp.SamplerzBatch(mus, 1.7, 1.28, out)
+	}
+}
+
+func BenchmarkSampleVec(b *testing.B) {
+	const n = 1024 // 2n for Falcon-512
+	mus, sigmas := make([]float64, n), make([]float64, n)
+	for i := range mus {
+		mus[i] = float64(i)*3.7 - 2000
+		sigmas[i] = 1.3 + 0.5*float64(i%7)/7
+	}
+	out := make([]int, n)
+	sp := NewSamplerFromSeed(testSeed)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sp.SampleVec(mus, sigmas, 1.28, out)
+	}
+}
+
+func TestApproxExpBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	xs := make([]float64, 1027) // not a multiple of the lanes
+	for i := range xs {
+		xs[i] = rng.Float64() * LN2
+	}
+	xs[0], xs[1] = 0, LN2
+	for _, scale := range []uint64{1 << 63, 1 << 31} {
+		sp, err := NewSamplerWithOptions(nil, WithApproxExpScale(scale))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ccs := range []float64{0, 0.7, 1} {
+			for _, n := range []int{0, 3, 4, 9, len(xs)} {
+				out := make([]uint64, n)
+				sp.approxexpBatch(xs[:n], ccs, out)
+				for i, y := range out {
+					if want := sp.approxexp(xs[i], ccs); y != want {
+						t.Fatalf("scale %#x, lane %d of %d: got %#x, want %#x", scale, i, n, y, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkApproxExp(b *testing.B) {
+	sp := newsampler(nil)
+	xs := make([]float64, 512)
+	for i := range xs {
+		xs[i] = float64(i) / 512 * LN2
+	}
+	out := make([]uint64, len(xs))
+	b.Run("Scalar", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j, x := range xs {
+				out[j] = sp.approxexp(x, 0.7)
+			}
+		}
+	})
+	b.Run("Batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sp.approxexpBatch(xs, 0.7, out)
+		}
+	})
+}
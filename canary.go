@@ -0,0 +1,69 @@
+package sampler
+
+import "fmt"
+
+// canarySeed seeds the SHAKE256 stream of the canary KAT.
+var canarySeed = []byte("FalconSampler canary")
+
+// canarySamples are consecutive Samplerz outputs of a sampler seeded with
+// canarySeed, which exercise RCDT and C end to end.
+var canarySamples = []struct {
+	mu, sigma, sigmin float64
+	z                 int
+}{
+	{-91.90471153063714, 1.7037990414754918, 1.2778336969128337, -94},
+	{7.9386734193997555, 1.6984647769450156, 1.2778336969128337, 10},
+	{0.5, 1.8, 1.2778336969128337, -1},
+	{141.19887611700221, 1.306241267501739, 1.298280334344292, 142},
+	{-0.25, 1.5, 1.2778336969128337, -2},
+	{343.0441653647399, 1.3052985443865464, 1.298280334344292, 344},
+	{12.75, 1.75, 1.298280334344292, 15},
+	{-28.990850086867255, 1.6984647769450156, 1.2778336969128337, -26},
+}
+
+// canaryExp are approxexp values, which are sensitive to any change of C
+// rather than only to the few that flip a rejection decision.
+var canaryExp = []struct {
+	x, ccs float64
+	y      uint64
+}{
+	{0, 0.75, 0x6000000000000000},
+	{0.125, 0.75, 0x54b83e6ec8866e19},
+	{0.25, 0.75, 0x4ac3cedc05861998},
+	{0.5, 0.75, 0x3a3a18f54ec21a88},
+	{0.6931471805599453, 0.75, 0x3000000000000516},
+}
+
+// canaryCheck runs the canary KAT against the tables and arithmetic of this
+// build, and reports the first mismatch. A mismatch means the binary was
+// miscompiled or its constants were corrupted or tampered with.
+func canaryCheck() error {
+	sp := newsampler(fromSeedSHAKE(canarySeed))
+	for i, v := range canarySamples {
+		z, err := sp.SamplerzErr(v.mu, v.sigma, v.sigmin)
+		if err != nil {
+			return err
+		}
+		if z != v.z {
+			return fmt.Errorf("sampler: canary sample %d is %d, want %d", i, z, v.z)
+		}
+	}
+	for _, v := range canaryExp {
+		if y := sp.approxexp(v.x, v.ccs); y != v.y {
+			return fmt.Errorf("sampler: canary approxexp(%v, %v) is %#x, want %#x", v.x, v.ccs, y, v.y)
+		}
+	}
+	return nil
+}
+
+// WithConstructionSelfCheck runs the canary KAT when the sampler is built, so
+// that NewSamplerWithOptions fails on a miscompiled or tampered binary instead
+// of returning a sampler producing wrong samples. It checks the built-in
+// tables and arithmetic, not the configuration set by other options. The
+// check costs a few samples, so it is opt-in; see also the falcon_selfcheck
+// build tag, which runs it once at startup.
+func WithConstructionSelfCheck() Option {
+	return func(sp *Sampler) error {
+		return canaryCheck()
+	}
+}
@@ -0,0 +1,66 @@
+package sampler
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+func TestCanary(t *testing.T) {
+	if err := canaryCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCanaryCorruptedC(t *testing.T) {
+	saved := C[5]
+	C[5] = new(uint256.Int).AddUint64(saved, 1<<20)
+	defer func() { C[5] = saved }()
+	if err := canaryCheck(); err == nil {
+		t.Fatal("canary passed with a corrupted C")
+	}
+}
+
+func TestCanaryCorruptedRCDT(t *testing.T) {
+	saved := RCDT[1]
+	RCDT[1] = NewBigNumFromHex("0x1")
+	defer func() { RCDT[1] = saved }()
+	if err := canaryCheck(); err == nil {
+		t.Fatal("canary passed with a corrupted RCDT")
+	}
+}
+
+func TestConstructionSelfCheck(t *testing.T) {
+	if _, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithConstructionSelfCheck()); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := C[5]
+	C[5] = new(uint256.Int).AddUint64(saved, 1<<20)
+	defer func() { C[5] = saved }()
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithConstructionSelfCheck())
+	if err == nil || sp != nil {
+		t.Fatal("construction succeeded with a corrupted C")
+	}
+}
+
+func TestApproxExpBerExpExported(t *testing.T) {
+	sp := NewSampler(nil)
+	for _, v := range canaryExp {
+		if y := sp.ApproxExp(v.x, v.ccs); y != v.y {
+			t.Errorf("ApproxExp(%v, %v) = %#x, want %#x", v.x, v.ccs, y, v.y)
+		}
+	}
+
+	a, b := NewSamplerFromSeed(testSeed), NewSamplerFromSeed(testSeed)
+	for i := 0; i < 1000; i++ {
+		x, ccs := float64(i)/100, 0.8
+		want, err := b.berexp(x, ccs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.BerExp(x, ccs); got != want {
+			t.Fatalf("BerExp(%v, %v) = %v, want %v", x, ccs, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sampler
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// chachaKeystreamLen is the length of a ChaCha20 keystream, 2^32 blocks of
+// 64 bytes.
+const chachaKeystreamLen = 1 << 38
+
+// chachaReader reads the keystream of a ChaCha20 cipher, of which left bytes
+// remain.
+type chachaReader struct {
+	c    *chacha20.Cipher
+	left uint64
+}
+
+// Read returns io.EOF once the keystream is exhausted, where the cipher
+// itself would panic.
+func (r *chachaReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	clear(p)
+	r.c.XORKeyStream(p, p)
+	r.left -= uint64(len(p))
+	return len(p), nil
+}
+
+// fromSeedChaCha20 returns the ChaCha20 keystream (RFC 8439) of key seed and
+// nonce nonce, starting from block counter 0. It panics unless seed is
+// chacha20.KeySize bytes and nonce chacha20.NonceSize bytes.
+func fromSeedChaCha20(seed, nonce []byte) io.Reader {
+	c, err := chacha20.NewUnauthenticatedCipher(seed, nonce)
+	if err != nil {
+		panic(fmt.Sprintf("sampler: invalid ChaCha20 seed or nonce: %v", err))
+	}
+	return &chachaReader{c: c, left: chachaKeystreamLen}
+}
+
+// NewSamplerFromChaCha returns a sampler drawing its randomness from the
+// ChaCha20 keystream of key seed and an all-zero nonce, for deployments that
+// expand their seeds with ChaCha20 rather than SHAKE256. It panics unless
+// seed is 32 bytes long.
+//
+// The keystream is limited to 256 GiB, which no realistic use of a sampler
+// reaches; past it, SamplerzErr returns an error wrapping ErrEntropyExhausted,
+// and Samplerz panics with it.
+func NewSamplerFromChaCha(seed []byte) *Sampler {
+	return newsampler(fromSeedChaCha20(seed, make([]byte, chacha20.NonceSize)))
+}
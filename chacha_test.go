@@ -0,0 +1,112 @@
+package sampler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+// TestChaCha20Vectors checks the keystream against the test vectors of
+// RFC 8439, appendix A.1 (#1) and section 2.4.2, the latter starting from
+// block 1.
+func TestChaCha20Vectors(t *testing.T) {
+	for _, tc := range []struct {
+		key, nonce string
+		skip       int // bytes to drop from the start of the keystream
+		want       string
+	}{
+		{
+			key:   "0000000000000000000000000000000000000000000000000000000000000000",
+			nonce: "000000000000000000000000",
+			want: "76b8e0ada0f13d90405d6ae55386bd28bdd219b8a08ded1aa836efcc8b770dc7" +
+				"da41597c5157488d7724e03fb8d84a376a43b8f41518a11cc387b669b2ee6586",
+		},
+		{
+			key:   "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			nonce: "000000000000004a00000000",
+			skip:  64,
+			want: "224f51f3401bd9e12fde276fb8631ded8c131f823d2c06e27e4fcaec9ef3cf78" +
+				"8a3b0aa372600a92b57974cded2b9334794cba40c63e34cdea212c4cf07d41b7",
+		},
+	} {
+		r := fromSeedChaCha20(decodeHexString(tc.key), decodeHexString(tc.nonce))
+		got := make([]byte, tc.skip+len(tc.want)/2)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatal(err)
+		}
+		if want := decodeHexString(tc.want); !bytes.Equal(got[tc.skip:], want) {
+			t.Errorf("key %s: got keystream %x, want %x", tc.key, got[tc.skip:], want)
+		}
+	}
+}
+
+func TestChaCha20Chunked(t *testing.T) {
+	key := make([]byte, 32)
+	nonce := make([]byte, 12)
+	whole := make([]byte, 1000)
+	io.ReadFull(fromSeedChaCha20(key, nonce), whole)
+
+	r := fromSeedChaCha20(key, nonce)
+	var chunked []byte
+	for _, n := range []int{1, 9, 63, 64, 65, 200, 598} {
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		chunked = append(chunked, b...)
+	}
+	if !bytes.Equal(chunked, whole) {
+		t.Error("keystream depends on the read sizes")
+	}
+}
+
+func TestNewSamplerFromChaCha(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, 32)
+	sp := NewSamplerFromChaCha(seed)
+	ref := newsampler(fromSeedChaCha20(seed, make([]byte, 12)))
+	for i := 0; i < 1000; i++ {
+		if z, want := sp.Samplerz(0.5, 1.7, 1.28), ref.Samplerz(0.5, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a 16-byte seed")
+		}
+	}()
+	NewSamplerFromChaCha(seed[:16])
+}
+
+func TestChaCha20Exhausted(t *testing.T) {
+	// Skip to the last block of the keystream.
+	newReader := func() *chachaReader {
+		r := fromSeedChaCha20(make([]byte, 32), make([]byte, 12)).(*chachaReader)
+		r.c.SetCounter(math.MaxUint32)
+		r.left = 64
+		return r
+	}
+
+	r := newReader()
+	b := make([]byte, 100)
+	if n, err := io.ReadFull(r, b[:10]); n != 10 || err != nil {
+		t.Fatalf("first read: got %d, %v", n, err)
+	}
+	if n, err := r.Read(b); n != 54 || err != nil {
+		t.Fatalf("read to the end: got %d, %v, want 54 bytes", n, err)
+	}
+	if n, err := r.Read(b); n != 0 || err != io.EOF {
+		t.Fatalf("read past the end: got %d, %v, want io.EOF", n, err)
+	}
+
+	sp := newsampler(newReader())
+	for i := 0; i < 64; i++ {
+		if _, err := sp.SamplerzErr(0.5, 1.7, 1.28); err != nil {
+			if !errors.Is(err, ErrEntropyExhausted) {
+				t.Fatalf("got %v, want ErrEntropyExhausted", err)
+			}
+			return
+		}
+	}
+	t.Fatal("64 samples from 64 bytes of keystream")
+}
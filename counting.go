@@ -0,0 +1,46 @@
+package sampler
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// CountingReader wraps a reader and counts the bytes read from it, e.g. to
+// budget the uniform bytes a signature consumes. Each Read is passed through
+// unchanged, with the same count, error and short reads, so io.ReadFull and
+// io.ReadAtLeast behave exactly as on the wrapped reader.
+type CountingReader struct {
+	r io.Reader
+	n atomic.Uint64
+}
+
+// NewCountingReader returns a CountingReader reading from r.
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+// Read reads from the wrapped reader and adds the bytes it returned to the
+// count, including those returned together with an error.
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.n.Add(uint64(n))
+	}
+	return n, err
+}
+
+// BytesRead returns the number of bytes read so far. It may be called while
+// another goroutine reads.
+func (c *CountingReader) BytesRead() uint64 {
+	return c.n.Load()
+}
+
+// NewSamplerCounting returns a sampler drawing its randomness from r, with
+// the default configuration, and the CountingReader through which it reads.
+// As the sampler reads exactly the bytes it uses, BytesRead is then the
+// randomness consumed by its samples; with WithReadBuffer it also counts the
+// buffered bytes not used yet.
+func NewSamplerCounting(r io.Reader) (*Sampler, *CountingReader) {
+	c := NewCountingReader(r)
+	return newsampler(c), c
+}
@@ -0,0 +1,56 @@
+package sampler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSamplerCounting(t *testing.T) {
+	sp, c := NewSamplerCounting(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	var want uint64
+	for i := 0; i < 1000; i++ {
+		z, iterations, err := ref.samplerz(float64(i)/7, 1.7, 1.28)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sp.Samplerz(float64(i)/7, 1.7, 1.28); got != z {
+			t.Fatalf("sample %d: got %d, want %d", i, got, z)
+		}
+		// A trial reads the base sampler draw and the sign byte, and
+		// BerExp at least one byte.
+		want += uint64(iterations) * uint64(RCDTprecLen+2)
+	}
+	if n := c.BytesRead(); n < want || n > want+want/16 {
+		t.Errorf("read %d bytes, want about %d", n, want)
+	}
+}
+
+func TestCountingReaderReadFull(t *testing.T) {
+	data := []byte("0123456789")
+	for _, tc := range []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"plain", func() io.Reader { return bytes.NewReader(data) }},
+		{"one byte", func() io.Reader { return iotest.OneByteReader(bytes.NewReader(data)) }},
+		{"data err", func() io.Reader { return iotest.DataErrReader(bytes.NewReader(data)) }},
+	} {
+		for _, size := range []int{0, 4, 10, 11} {
+			c := NewCountingReader(tc.r())
+			got := make([]byte, size)
+			n, err := io.ReadFull(c, got)
+			want := make([]byte, size)
+			wantN, wantErr := io.ReadFull(tc.r(), want)
+			if n != wantN || !errors.Is(err, wantErr) || !bytes.Equal(got, want) {
+				t.Errorf("%s, %d bytes: got %d, %v, want %d, %v", tc.name, size, n, err, wantN, wantErr)
+			}
+			if c.BytesRead() != uint64(n) {
+				t.Errorf("%s, %d bytes: counted %d, read %d", tc.name, size, c.BytesRead(), n)
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package sampler_test
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	sampler "github.com/realForbis/FalconSampler"
+)
+
+func ExampleNewSamplerFromSeed() {
+	sp := sampler.NewSamplerFromSeed([]byte("example seed"))
+	for i := 0; i < 5; i++ {
+		fmt.Print(sp.Samplerz(10.5, 1.7, 1.28), " ")
+	}
+	fmt.Println()
+	// Output: 9 9 12 13 9
+}
+
+func ExampleNew() {
+	sp := sampler.New(rand.Reader)
+	z := sp.SampleZ(10.5, 1.7, 1.28)
+	fmt.Println(z > -10 && z < 30)
+	// Output: true
+}
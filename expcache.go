@@ -0,0 +1,73 @@
+package sampler
+
+import (
+	"errors"
+	"math"
+)
+
+// expCacheQuantum is the precision, as a power of two, to which approxexp
+// inputs are rounded down by the cache of WithExpCache.
+const expCacheQuantum = 40
+
+// expCacheEntry memoizes approxexp(rq * 2^-expCacheQuantum, ccs).
+type expCacheEntry struct {
+	rq    uint64
+	ccs   float64
+	y     uint64
+	valid bool
+}
+
+// WithExpCache memoizes approxexp in a direct-mapped cache of size entries,
+// keyed on the reduced exponent r of berexp, rounded down to a multiple of
+// 2^-40, and ccs. With few distinct centers and sigmas, as in a batch with
+// clustered centers, the same keys recur and the polynomial is not
+// recomputed.
+//
+// The rounding changes the exponent by less than 2^-40, so the acceptance
+// probability by a relative 2^-40 at most, a tiny departure from the
+// specification that flips an acceptance decision with probability below
+// 2^-40 per trial.
+//
+// The cache is off by default, and should stay off for signing with secret
+// centers: whether a lookup hits depends on the secret values, and so does
+// its timing, which opens a side channel. It is therefore rejected together
+// with WithConstantTime, WithConstantTimeBaseSampler or
+// WithConstantTimeBerExp, in either order.
+func WithExpCache(size int) Option {
+	return func(sp *Sampler) error {
+		if size <= 0 {
+			return errors.New("sampler: exp cache size must be positive")
+		}
+		sp.expCache = make([]expCacheEntry, size)
+		return sp.checkExpCacheConstantTime()
+	}
+}
+
+// errConstantTimeExpCache is returned when WithExpCache and any of the
+// constant-time options are both given.
+var errConstantTimeExpCache = errors.New("sampler: WithExpCache cannot be combined with the constant-time options")
+
+// checkExpCacheConstantTime returns errConstantTimeExpCache if sp has both
+// an exp cache and a constant-time option. Each of these options calls it
+// last, so that the combination is rejected whichever comes second.
+func (sp *Sampler) checkExpCacheConstantTime() error {
+	if sp.expCache != nil && (sp.constantTimeBaseSampler || sp.constantTimeBerExp) {
+		return errConstantTimeExpCache
+	}
+	return nil
+}
+
+// cachedApproxexp is approxexp, through the cache of WithExpCache if any,
+// given also zccs = fixedCCS(ccs).
+func (sp *Sampler) cachedApproxexp(r, ccs float64, zccs uint64) uint64 {
+	if sp.expCache == nil {
+		return sp.approxexpFixed(uint64(r*sp.expScale), zccs)
+	}
+	rq := uint64(r * (1 << expCacheQuantum))
+	h := (rq ^ math.Float64bits(ccs)) * 0x9E3779B97F4A7C15 // Fibonacci hashing
+	e := &sp.expCache[(h>>32)%uint64(len(sp.expCache))]
+	if !e.valid || e.rq != rq || e.ccs != ccs {
+		*e = expCacheEntry{rq: rq, ccs: ccs, y: sp.approxexpFixed(uint64(float64(rq)/(1<<expCacheQuantum)*sp.expScale), zccs), valid: true}
+	}
+	return e.y
+}
@@ -0,0 +1,68 @@
+package sampler
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// clusteredCenters returns n centers taken among 4 distinct values.
+func clusteredCenters(n int) []float64 {
+	mus := make([]float64, n)
+	for i := range mus {
+		mus[i] = []float64{-12.25, 0.4, 3.5, 71.9}[i%4]
+	}
+	return mus
+}
+
+func TestExpCache(t *testing.T) {
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithExpCache(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := newsampler(fromSeedSHAKE(testSeed))
+
+	// approxexp within the quantization: 2^-40 of exp(-r) at the 2^63 scale.
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		r, ccs := rng.Float64()*LN2, 0.5+rng.Float64()/2
+		y, want := sp.cachedApproxexp(r, ccs, sp.fixedCCS(ccs)), ref.approxexp(r, ccs)
+		if d := int64(y - want); d < 0 || d > 1<<23 {
+			t.Fatalf("cached approxexp(%v, %v) = %#x, want %#x up to 2^23", r, ccs, y, want)
+		}
+		if again := sp.cachedApproxexp(r, ccs, sp.fixedCCS(ccs)); again != y {
+			t.Fatalf("cache hit approxexp(%v, %v) = %#x, want %#x", r, ccs, again, y)
+		}
+	}
+
+	sp.Reseed(testSeed)
+	ref.Reseed(testSeed)
+	for i, mu := range clusteredCenters(20000) {
+		if z, want := sp.Samplerz(mu, 1.7, 1.28), ref.Samplerz(mu, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d with the cache, want %d", i, z, want)
+		}
+	}
+
+	if _, err := NewSamplerWithOptions(nil, WithExpCache(0)); err == nil {
+		t.Error("expected an error for an empty cache")
+	}
+}
+
+func benchmarkClustered(b *testing.B, opts ...Option) {
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	mus := clusteredCenters(1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sp.Samplerz(mus[i%len(mus)], 1.7, 1.28)
+	}
+}
+
+func BenchmarkSamplerzClustered(b *testing.B) {
+	benchmarkClustered(b)
+}
+
+func BenchmarkSamplerzClusteredExpCache(b *testing.B) {
+	benchmarkClustered(b, WithExpCache(256))
+}
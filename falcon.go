@@ -0,0 +1,154 @@
+package sampler
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Signature standard deviations of Falcon, from which the per-leaf sigma of
+// the ffSampling tree is derived, to full double precision as in the
+// reference implementation; the specification prints them rounded, as
+// 165.736617183 and 168.388571447.
+const (
+	SigmaFalcon512  float64 = 165.7366171829776
+	SigmaFalcon1024 float64 = 168.38857144654395
+)
+
+// FalconQ is the modulus q of Falcon.
+const FalconQ = 12289
+
+// Params are the Gaussian parameters of a Falcon parameter set, from table
+// 3.3 of the specification: the signature standard deviation Sigma, and the
+// bounds Sigmin and MaxSigma of the per-leaf standard deviations of the
+// ffSampling tree.
+type Params struct {
+	N        int // degree of the ring
+	Sigma    float64
+	Sigmin   float64
+	MaxSigma float64
+}
+
+// Falcon512Params and Falcon1024Params are the parameters of Falcon-512 and
+// Falcon-1024, to full double precision as in the reference implementation,
+// with SigmaFalcon512 and SigmaFalcon1024 as their sigmas.
+var (
+	Falcon512Params = Params{
+		N:        512,
+		Sigma:    SigmaFalcon512,
+		Sigmin:   1.2778336969128337,
+		MaxSigma: MAX_SIGMA,
+	}
+	Falcon1024Params = Params{
+		N:        1024,
+		Sigma:    SigmaFalcon1024,
+		Sigmin:   1.298280334344292,
+		MaxSigma: MAX_SIGMA,
+	}
+)
+
+// WithGlobalSigma sets the signature sigma used by SamplerzFromGSNorm, which
+// defaults to SigmaFalcon512.
+func WithGlobalSigma(sigma float64) Option {
+	return func(sp *Sampler) error {
+		if err := validateSigma(sigma); err != nil {
+			return err
+		}
+		sp.sigmaGlobal = sigma
+		return nil
+	}
+}
+
+// SamplerzFromGSNorm samples a leaf of the Falcon ffSampling tree, whose
+// sigma is the signature sigma divided by the Gram-Schmidt norm gsNorm of the
+// corresponding basis vector: it returns Samplerz(mu, sigmaGlobal / gsNorm,
+// sigmin). It panics if the resulting sigma is out of the range of Samplerz,
+// which for a valid Falcon key never happens.
+func (sp *Sampler) SamplerzFromGSNorm(mu, gsNorm, sigmin float64) int {
+	sigma := sp.sigmaGlobal / gsNorm
+	if err := sp.checkSigma(sigma, sigmin); err != nil {
+		panic(err)
+	}
+	return sp.Samplerz(mu, sigma, sigmin)
+}
+
+// SigminForDegree returns the sigmin of the Falcon parameter set of degree n,
+// as defined by the specification:
+//
+//	sigmin = 1/pi * sqrt(ln(4n * (1 + 1/eps)) / 2),  eps = 1 / sqrt(lambda * 2^64)
+//
+// for at most 2^64 signature queries, with the security level lambda = 256
+// for n = 1024 and 128 otherwise. The result matches Falcon512Params and
+// Falcon1024Params to within a few units in the last place, the rounding of
+// the formula in floating point. n must be a power of two from 2 to 1024.
+func SigminForDegree(n int) (float64, error) {
+	if n < 2 || n > 1024 || bits.OnesCount(uint(n)) != 1 {
+		return 0, fmt.Errorf("sampler: degree %d is not a power of two from 2 to 1024", n)
+	}
+	lambda := 128.0
+	if n == 1024 {
+		lambda = 256
+	}
+	eps := 1 / math.Sqrt(lambda*0x1p64)
+	return math.Sqrt(math.Log(4*float64(n)*(1+1/eps))/2) / math.Pi, nil
+}
+
+// SamplerzWithParams samples a leaf of the ffSampling tree of the parameter
+// set p, of center mu, whose basis vector has the Gram-Schmidt norm gsNorm: it
+// returns Samplerz(mu, p.Sigma / gsNorm, p.Sigmin). The per-leaf sigma
+// depends on the key, so it is derived here rather than carried by p. It
+// panics if that sigma is not between p.Sigmin and p.MaxSigma, or out of the
+// range of Samplerz, which for a valid key never happens.
+func (sp *Sampler) SamplerzWithParams(p Params, mu, gsNorm float64) int {
+	sigma := p.Sigma / gsNorm
+	if !(p.Sigmin < sigma && sigma < p.MaxSigma) {
+		panic(fmt.Errorf("%w: sigma = %v out of (%v, %v)", ErrInvalidSigma, sigma, p.Sigmin, p.MaxSigma))
+	}
+	if err := sp.checkSigma(sigma, p.Sigmin); err != nil {
+		panic(err)
+	}
+	return sp.Samplerz(mu, sigma, p.Sigmin)
+}
+
+// SamplerzModQ returns Samplerz(mu, sigma, sigmin) reduced modulo q into
+// [0, q), negative samples included, e.g. for q = FalconQ. It panics if q is
+// not positive.
+func (sp *Sampler) SamplerzModQ(mu, sigma, sigmin float64, q int) int {
+	if q <= 0 {
+		panic("sampler: SamplerzModQ with a non-positive modulus")
+	}
+	return ((sp.Samplerz(mu, sigma, sigmin) % q) + q) % q
+}
+
+// signingNoiseDomain separates the seeds of GenerateSigningNoise from any
+// other use of the key seed.
+const signingNoiseDomain = "FalconSampler/GenerateSigningNoise"
+
+// GenerateSigningNoise returns n samples of Samplerz(0, sigma, sigmin) drawn
+// from a SHAKE256 stream seeded with signingNoiseDomain || uint64(len(keySeed))
+// || keySeed || message, the length prefix keeping (keySeed, message) pairs
+// apart. As in a derandomized signer, the noise is then a function of the key
+// and the message only, which gives implementers of a full signer a
+// reproducible target for their sampler.
+//
+// n must be a power of two, like the Falcon degree, and the parameters must
+// satisfy 1 < sigmin < sigma < MAX_SIGMA; otherwise an error wrapping
+// ErrInvalidSigma is returned for the latter.
+func GenerateSigningNoise(keySeed, message []byte, n int, sigma, sigmin float64) ([]int16, error) {
+	if n <= 0 || bits.OnesCount(uint(n)) != 1 {
+		return nil, fmt.Errorf("sampler: noise length %d is not a power of two", n)
+	}
+	if err := checkSigmaRange(sigma, sigmin, MAX_SIGMA); err != nil {
+		return nil, err
+	}
+	sp := newSeededSampler(domainSeed(signingNoiseDomain, uint64(len(keySeed)), keySeed, message))
+	noise := make([]int16, n)
+	for i := range noise {
+		z, err := sp.SamplerzErr(0, sigma, sigmin)
+		if err != nil {
+			return nil, err
+		}
+		noise[i] = int16(z)
+	}
+	return noise, nil
+}
@@ -0,0 +1,202 @@
+package sampler
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSamplerzFromGSNorm(t *testing.T) {
+	for _, tc := range []struct {
+		global float64
+		gsNorm float64
+		sigma  float64 // reference leaf sigma
+		sigmin float64
+	}{
+		{SigmaFalcon512, 100, 1.6573661718297759, 1.2778336969128337},
+		{SigmaFalcon512, 129.7, 1.2778459304778536, 1.2778336969128337},
+		{SigmaFalcon512, 91.1, 1.819282296190753, 1.2778336969128337},
+		{SigmaFalcon1024, 100, 1.6838857144654396, 1.298280334344292},
+		{SigmaFalcon1024, 125.5, 1.3417416051517446, 1.298280334344292},
+	} {
+		sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithGlobalSigma(tc.global))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := newsampler(fromSeedSHAKE(testSeed))
+		for i := 0; i < 100; i++ {
+			mu := float64(i) - 49.7
+			if z, want := sp.SamplerzFromGSNorm(mu, tc.gsNorm, tc.sigmin), ref.Samplerz(mu, tc.sigma, tc.sigmin); z != want {
+				t.Fatalf("gsNorm %v: got %d, want %d", tc.gsNorm, z, want)
+			}
+		}
+	}
+}
+
+func TestSamplerzFromGSNormOutOfRange(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, gsNorm := range []float64{50, 140} {
+		func() {
+			defer func() {
+				err, _ := recover().(error)
+				if !errors.Is(err, ErrInvalidSigma) {
+					t.Errorf("gsNorm %v: got panic %v, want ErrInvalidSigma", gsNorm, err)
+				}
+			}()
+			sp.SamplerzFromGSNorm(0, gsNorm, 1.2778336969128337)
+		}()
+	}
+}
+
+func TestSamplerzModQ(t *testing.T) {
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for _, q := range []int{FalconQ, 7, 1} {
+		for _, mu := range []float64{-91.90471153063714, -0.3, 0, 5.5, 12290.2} {
+			for i := 0; i < 100; i++ {
+				got := sp.SamplerzModQ(mu, sigma, sigmin, q)
+				z := ref.Samplerz(mu, sigma, sigmin)
+				if got < 0 || got >= q || (z-got)%q != 0 {
+					t.Fatalf("q %d: %d reduced to %d", q, z, got)
+				}
+			}
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for q = 0")
+		}
+	}()
+	sp.SamplerzModQ(0, sigma, sigmin, 0)
+}
+
+func TestGenerateSigningNoise(t *testing.T) {
+	key, msg := []byte("key seed"), []byte("message")
+	a, err := GenerateSigningNoise(key, msg, 512, 1.7037990414754918, 1.2778336969128337)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := GenerateSigningNoise(key, msg, 512, 1.7037990414754918, 1.2778336969128337)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 512 {
+		t.Fatalf("got %d samples, want 512", len(a))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("sample %d: got %d and %d for the same key and message", i, a[i], b[i])
+		}
+	}
+
+	// Another message, or the same bytes split differently between key
+	// and message, give other noise.
+	for _, tc := range []struct{ key, msg []byte }{
+		{key, []byte("massage")},
+		{[]byte("key see"), []byte("dmessage")},
+	} {
+		c, err := GenerateSigningNoise(tc.key, tc.msg, 512, 1.7037990414754918, 1.2778336969128337)
+		if err != nil {
+			t.Fatal(err)
+		}
+		same := true
+		for i := range a {
+			same = same && a[i] == c[i]
+		}
+		if same {
+			t.Errorf("key %q and message %q give the same noise", tc.key, tc.msg)
+		}
+	}
+}
+
+func TestGenerateSigningNoiseInvalid(t *testing.T) {
+	for _, n := range []int{0, -4, 3, 1000} {
+		if _, err := GenerateSigningNoise(nil, nil, n, 1.7, 1.28); err == nil {
+			t.Errorf("n = %d: expected an error", n)
+		}
+	}
+	if _, err := GenerateSigningNoise(nil, nil, 512, 2, 1.28); !errors.Is(err, ErrInvalidSigma) {
+		t.Errorf("sigma = 2: got %v, want ErrInvalidSigma", err)
+	}
+}
+
+func TestParams(t *testing.T) {
+	// Values of the reference implementation, and sigma = 1.17 * sqrt(q) *
+	// sigmin to within rounding.
+	for _, tc := range []struct {
+		p             Params
+		n             int
+		sigma, sigmin float64
+		rounded       float64 // sigma as printed in the specification
+	}{
+		{Falcon512Params, 512, 165.7366171829776, 1.2778336969128337, 165.736617183},
+		{Falcon1024Params, 1024, 168.38857144654395, 1.298280334344292, 168.388571447},
+	} {
+		if tc.p.N != tc.n || tc.p.Sigma != tc.sigma || tc.p.Sigmin != tc.sigmin || tc.p.MaxSigma != 1.8205 {
+			t.Errorf("n = %d: got %+v", tc.n, tc.p)
+		}
+		if s := 1.17 * math.Sqrt(FalconQ) * tc.p.Sigmin; math.Abs(s-tc.p.Sigma) > 1e-12 {
+			t.Errorf("n = %d: 1.17 * sqrt(q) * sigmin = %v, want %v", tc.n, s, tc.p.Sigma)
+		}
+		if math.Abs(tc.rounded-tc.p.Sigma) > 5e-10 {
+			t.Errorf("n = %d: rounded sigma %v, want %v", tc.n, tc.rounded, tc.p.Sigma)
+		}
+	}
+}
+
+func TestSamplerzWithParams(t *testing.T) {
+	for _, p := range []Params{Falcon512Params, Falcon1024Params} {
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		ref := newsampler(fromSeedSHAKE(testSeed))
+		for _, gsNorm := range []float64{95, 100, 125} {
+			for i := 0; i < 100; i++ {
+				mu := float64(i) - 49.7
+				if z, want := sp.SamplerzWithParams(p, mu, gsNorm), ref.Samplerz(mu, p.Sigma/gsNorm, p.Sigmin); z != want {
+					t.Fatalf("n = %d, gsNorm %v: got %d, want %d", p.N, gsNorm, z, want)
+				}
+			}
+		}
+		for _, gsNorm := range []float64{50, 140} {
+			func() {
+				defer func() {
+					if err, _ := recover().(error); !errors.Is(err, ErrInvalidSigma) {
+						t.Errorf("n = %d, gsNorm %v: got panic %v, want ErrInvalidSigma", p.N, gsNorm, err)
+					}
+				}()
+				sp.SamplerzWithParams(p, 0, gsNorm)
+			}()
+		}
+	}
+}
+
+func TestSigminForDegree(t *testing.T) {
+	for _, p := range []Params{Falcon512Params, Falcon1024Params} {
+		sigmin, err := SigminForDegree(p.N)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(sigmin-p.Sigmin) > 4*0x1p-52 {
+			t.Errorf("n = %d: got %v, want %v", p.N, sigmin, p.Sigmin)
+		}
+	}
+	// sigmin grows with log n.
+	prev := 0.0
+	for n := 2; n <= 512; n *= 2 {
+		sigmin, err := SigminForDegree(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(prev < sigmin && sigmin < Falcon512Params.Sigmin+1e-15) {
+			t.Errorf("n = %d: got %v after %v", n, sigmin, prev)
+		}
+		prev = sigmin
+	}
+	for _, n := range []int{-2, 0, 1, 3, 768, 2048} {
+		if _, err := SigminForDegree(n); err == nil {
+			t.Errorf("n = %d: expected an error", n)
+		}
+	}
+}
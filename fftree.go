@@ -0,0 +1,219 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+)
+
+// fftRoots returns the roots of x^n + 1 in the order of the FFT: the roots of
+// x^2n + 1 come in pairs (w, -w), where w is the principal square root of the
+// root of x^n + 1 of the same index. This is the order that makes splitFFT
+// and mergeFFT the even/odd decomposition f(x) = f0(x^2) + x f1(x^2).
+func fftRoots(n int) []complex128 {
+	roots := []complex128{-1}
+	for len(roots) < n {
+		next := make([]complex128, 2*len(roots))
+		for i, r := range roots {
+			w := cmplx.Sqrt(r)
+			next[2*i], next[2*i+1] = w, -w
+		}
+		roots = next
+	}
+	return roots
+}
+
+// splitFFT returns the FFTs of f0 and f1, where f(x) = f0(x^2) + x f1(x^2),
+// given the FFT of f.
+func splitFFT(f []complex128) (f0, f1 []complex128) {
+	w := fftRoots(len(f))
+	f0 = make([]complex128, len(f)/2)
+	f1 = make([]complex128, len(f)/2)
+	for i := range f0 {
+		f0[i] = (f[2*i] + f[2*i+1]) / 2
+		f1[i] = (f[2*i] - f[2*i+1]) / 2 * cmplx.Conj(w[2*i])
+	}
+	return f0, f1
+}
+
+// mergeFFT is the inverse of splitFFT.
+func mergeFFT(f0, f1 []complex128) []complex128 {
+	w := fftRoots(2 * len(f0))
+	f := make([]complex128, 2*len(f0))
+	for i := range f0 {
+		t := w[2*i] * f1[i]
+		f[2*i], f[2*i+1] = f0[i]+t, f0[i]-t
+	}
+	return f
+}
+
+// FFT returns the values of the polynomial of coefficients f, of degree
+// below n = len(f), at the roots of x^n + 1, in the order used by
+// NewFalconTree and SampleLattice: products modulo x^n + 1 are then
+// pointwise products. n must be a power of two.
+func FFT(f []float64) []complex128 {
+	if len(f) == 1 {
+		return []complex128{complex(f[0], 0)}
+	}
+	f0 := make([]float64, len(f)/2)
+	f1 := make([]float64, len(f)/2)
+	for i := range f0 {
+		f0[i], f1[i] = f[2*i], f[2*i+1]
+	}
+	return mergeFFT(FFT(f0), FFT(f1))
+}
+
+// InvFFT is the inverse of FFT, returning the real parts of the coefficients.
+func InvFFT(f []complex128) []float64 {
+	if len(f) == 1 {
+		return []float64{real(f[0])}
+	}
+	f0, f1 := splitFFT(f)
+	p0, p1 := InvFFT(f0), InvFFT(f1)
+	p := make([]float64, len(f))
+	for i := range p0 {
+		p[2*i], p[2*i+1] = p0[i], p1[i]
+	}
+	return p
+}
+
+// FalconTree is the Falcon tree of a basis, over which SampleLattice walks
+// the ffSampling algorithm of the specification.
+type FalconTree struct {
+	root   *treeNode
+	n      int
+	sigmin float64
+}
+
+// treeNode is a node of a FalconTree: an internal node holds the FFT of L10
+// of the LDL decomposition of its Gram matrix, a leaf the sigma of Samplerz.
+type treeNode struct {
+	l10         []complex128
+	left, right *treeNode
+	sigma       float64
+}
+
+// NewFalconTree returns the Falcon tree of the parameter set p for the
+// self-adjoint Gram matrix [[g00, g01], [adj(g01), g11]] of a basis of
+// degree n = len(g00), given in the FFT domain, computed with the ffLDL
+// decomposition of the specification. Its leaves are normalized to the
+// sigma p.Sigma / sqrt(d) of Samplerz, d the leaf of the decomposition.
+//
+// n must be a power of two of at least 2. An error wrapping ErrInvalidSigma
+// is returned if a leaf sigma is not between p.Sigmin and p.MaxSigma, which
+// for a valid Falcon key never happens.
+func NewFalconTree(g00, g01, g11 []complex128, p Params) (*FalconTree, error) {
+	n := len(g00)
+	if n < 2 || bits.OnesCount(uint(n)) != 1 {
+		return nil, fmt.Errorf("sampler: tree of degree %d is not a power of two of at least 2", n)
+	}
+	if len(g01) != n || len(g11) != n {
+		return nil, errors.New("sampler: Gram matrix entries of different degrees")
+	}
+	root, err := ffLDL(g00, g01, g11, p)
+	if err != nil {
+		return nil, err
+	}
+	return &FalconTree{root: root, n: n, sigmin: p.Sigmin}, nil
+}
+
+// ffLDL builds the subtree of the Gram matrix [[g00, g01], [adj(g01), g11]].
+func ffLDL(g00, g01, g11 []complex128, p Params) (*treeNode, error) {
+	n := len(g00)
+	// G = L D L*, with L = [[1, 0], [l10, 1]] and D = diag(d00, d11).
+	l10 := make([]complex128, n)
+	d11 := make([]complex128, n)
+	for i := range g00 {
+		l10[i] = cmplx.Conj(g01[i]) / g00[i]
+		d11[i] = g11[i] - l10[i]*g01[i]
+	}
+	node := &treeNode{l10: l10}
+	for i, d := range [][]complex128{g00, d11} {
+		var child *treeNode
+		var err error
+		if n == 2 {
+			// A self-adjoint polynomial modulo x^2 + 1 is a constant.
+			child, err = newLeaf(real(d[0]), p)
+		} else {
+			d0, d1 := splitFFT(d)
+			child, err = ffLDL(d0, d1, d0, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			node.left = child
+		} else {
+			node.right = child
+		}
+	}
+	return node, nil
+}
+
+func newLeaf(d float64, p Params) (*treeNode, error) {
+	sigma := p.Sigma / math.Sqrt(d)
+	if !(p.Sigmin < sigma && sigma < p.MaxSigma) {
+		return nil, fmt.Errorf("%w: leaf sigma = %v out of (%v, %v)", ErrInvalidSigma, sigma, p.Sigmin, p.MaxSigma)
+	}
+	return &treeNode{sigma: sigma}, nil
+}
+
+// SampleLattice samples a lattice point close to the target t = (t0, t1) with
+// the ffSampling algorithm of the specification over tree, drawing every
+// coordinate with Samplerz at the leaves. centers holds the 2n coefficients
+// of t0 followed by those of t1, and the result the coefficients of z0
+// followed by those of z1, for (t - z) B short, B the basis of the tree.
+//
+// It panics if centers is not of length 2n, and returns the error of
+// SamplerzErr if a leaf sample fails.
+func (sp *Sampler) SampleLattice(tree *FalconTree, centers []float64) ([]int, error) {
+	if len(centers) != 2*tree.n {
+		panic("sampler: SampleLattice centers of the wrong length")
+	}
+	z0, z1, err := sp.ffSampling(FFT(centers[:tree.n]), FFT(centers[tree.n:]), tree.root, tree.sigmin)
+	if err != nil {
+		return nil, err
+	}
+	z := make([]int, 0, 2*tree.n)
+	for _, p := range [][]complex128{z0, z1} {
+		for _, c := range InvFFT(p) {
+			z = append(z, int(math.Round(c)))
+		}
+	}
+	return z, nil
+}
+
+// ffSampling is algorithm 11 of the specification, in the FFT domain.
+func (sp *Sampler) ffSampling(t0, t1 []complex128, node *treeNode, sigmin float64) (z0, z1 []complex128, err error) {
+	if node.l10 == nil {
+		a, err := sp.SamplerzErr(real(t0[0]), node.sigma, sigmin)
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := sp.SamplerzErr(real(t1[0]), node.sigma, sigmin)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []complex128{complex(float64(a), 0)}, []complex128{complex(float64(b), 0)}, nil
+	}
+
+	s0, s1 := splitFFT(t1)
+	s0, s1, err = sp.ffSampling(s0, s1, node.right, sigmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	z1 = mergeFFT(s0, s1)
+
+	t0b := make([]complex128, len(t0))
+	for i := range t0 {
+		t0b[i] = t0[i] + (t1[i]-z1[i])*node.l10[i]
+	}
+	s0, s1 = splitFFT(t0b)
+	s0, s1, err = sp.ffSampling(s0, s1, node.left, sigmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mergeFFT(s0, s1), z1, nil
+}
@@ -0,0 +1,245 @@
+package sampler
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// mulNegacyclic returns a * b modulo x^n + 1.
+func mulNegacyclic(a, b []float64) []float64 {
+	n := len(a)
+	c := make([]float64, n)
+	for i := range a {
+		for j := range b {
+			if k := i + j; k < n {
+				c[k] += a[i] * b[j]
+			} else {
+				c[k-n] -= a[i] * b[j]
+			}
+		}
+	}
+	return c
+}
+
+func TestFFT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 1; n <= 1024; n *= 2 {
+		a, b := make([]float64, n), make([]float64, n)
+		for i := range a {
+			a[i], b[i] = rng.NormFloat64(), rng.NormFloat64()
+		}
+		fa, fb := FFT(a), FFT(b)
+		for i, c := range InvFFT(fa) {
+			if math.Abs(c-a[i]) > 1e-9 {
+				t.Fatalf("n = %d: InvFFT(FFT(a))[%d] = %v, want %v", n, i, c, a[i])
+			}
+		}
+		prod := make([]complex128, n)
+		for i := range prod {
+			prod[i] = fa[i] * fb[i]
+		}
+		want := mulNegacyclic(a, b)
+		for i, c := range InvFFT(prod) {
+			if math.Abs(c-want[i]) > 1e-8*float64(n) {
+				t.Fatalf("n = %d: coefficient %d of the product is %v, want %v", n, i, c, want[i])
+			}
+		}
+		// The FFT values are those at the roots of x^n + 1.
+		for i, r := range fftRoots(n) {
+			if d := cmplx.Abs(cmplx.Pow(r, complex(float64(n), 0)) + 1); d > 1e-9 {
+				t.Fatalf("n = %d: root %d is off by %v", n, i, d)
+			}
+		}
+	}
+}
+
+// basis is a basis [[b00, b01], [b10, b11]] of polynomials modulo x^n + 1.
+type basis [2][2][]float64
+
+// randomBasis returns c times the identity plus small perturbations, so
+// that its Gram-Schmidt norms are all close to c.
+func randomBasis(rng *rand.Rand, n int, c float64) basis {
+	var b basis
+	for i := range b {
+		for j := range b[i] {
+			b[i][j] = make([]float64, n)
+			for k := range b[i][j] {
+				b[i][j][k] = float64(rng.Intn(3) - 1)
+			}
+		}
+		b[i][i][0] += c
+	}
+	return b
+}
+
+// gram returns the FFT of the Gram matrix B B* of b.
+func (b basis) gram() (g00, g01, g11 []complex128) {
+	n := len(b[0][0])
+	var f [2][2][]complex128
+	for i := range b {
+		for j := range b[i] {
+			f[i][j] = FFT(b[i][j])
+		}
+	}
+	g00, g01, g11 = make([]complex128, n), make([]complex128, n), make([]complex128, n)
+	for k := 0; k < n; k++ {
+		row := func(i, j int) complex128 {
+			return f[i][0][k]*cmplx.Conj(f[j][0][k]) + f[i][1][k]*cmplx.Conj(f[j][1][k])
+		}
+		g00[k], g01[k], g11[k] = row(0, 0), row(0, 1), row(1, 1)
+	}
+	return g00, g01, g11
+}
+
+// errorNorm returns the squared norm of (t - z) B.
+func (b basis) errorNorm(t []float64, z []int) float64 {
+	n := len(b[0][0])
+	e0, e1 := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		e0[i], e1[i] = t[i]-float64(z[i]), t[n+i]-float64(z[n+i])
+	}
+	var norm float64
+	for j := 0; j < 2; j++ {
+		v0, v1 := mulNegacyclic(e0, b[0][j]), mulNegacyclic(e1, b[1][j])
+		for i := range v0 {
+			norm += (v0[i] + v1[i]) * (v0[i] + v1[i])
+		}
+	}
+	return norm
+}
+
+func TestSampleLatticeDiagonal(t *testing.T) {
+	// For c times the identity, L10 = 0 and every leaf has sigma p.Sigma /
+	// c: the coordinates are sampled independently, in the order of the
+	// walk.
+	p := Params{Sigma: 15, Sigmin: 1.28, MaxSigma: MAX_SIGMA}
+	for _, n := range []int{2, 4, 32} {
+		one := make([]float64, n)
+		one[0] = 10
+		b := basis{{one, make([]float64, n)}, {make([]float64, n), one}}
+		g00, g01, g11 := b.gram()
+		tree, err := NewFalconTree(g00, g01, g11, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		centers := make([]float64, 2*n)
+		for i := range centers {
+			centers[i] = float64(i)*1.37 - 20
+		}
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		z, err := sp.SampleLattice(tree, centers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ref := newsampler(fromSeedSHAKE(testSeed))
+		var walk func(t0, t1 []float64) ([]int, []int)
+		interleave := func(a, b []int) []int {
+			c := make([]int, 0, 2*len(a))
+			for i := range a {
+				c = append(c, a[i], b[i])
+			}
+			return c
+		}
+		split := func(f []float64) ([]float64, []float64) {
+			f0, f1 := make([]float64, len(f)/2), make([]float64, len(f)/2)
+			for i := range f0 {
+				f0[i], f1[i] = f[2*i], f[2*i+1]
+			}
+			return f0, f1
+		}
+		walk = func(t0, t1 []float64) ([]int, []int) {
+			if len(t0) == 1 {
+				return []int{ref.Samplerz(t0[0], 1.5, 1.28)}, []int{ref.Samplerz(t1[0], 1.5, 1.28)}
+			}
+			z1 := interleave(walk(split(t1)))
+			z0 := interleave(walk(split(t0)))
+			return z0, z1
+		}
+		z0, z1 := walk(centers[:n], centers[n:])
+		want := append(z0, z1...)
+		for i := range want {
+			if z[i] != want[i] {
+				t.Fatalf("n = %d: coordinate %d is %d, want %d", n, i, z[i], want[i])
+			}
+		}
+	}
+}
+
+func TestSampleLattice(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	const n = 16
+	const c = 10.0
+	p := Params{N: n, Sigma: 1.5 * c, Sigmin: 1.28, MaxSigma: MAX_SIGMA}
+	b := randomBasis(rng, n, c)
+	g00, g01, g11 := b.gram()
+	tree, err := NewFalconTree(g00, g01, g11, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (t - z) B has the covariance sigma^2 I in the Gram-Schmidt basis, so
+	// its expected squared norm is 2n sigma^2, whatever the target.
+	meanNorm := func(tree *FalconTree) float64 {
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		const trials = 2000
+		var mean float64
+		target := make([]float64, 2*n)
+		for k := 0; k < trials; k++ {
+			for i := range target {
+				target[i] = rng.NormFloat64() * 50
+			}
+			z, err := sp.SampleLattice(tree, target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mean += b.errorNorm(target, z) / trials
+		}
+		return mean
+	}
+	want := 2 * n * p.Sigma * p.Sigma
+	if mean := meanNorm(tree); math.Abs(mean-want) > 0.05*want {
+		t.Errorf("mean squared error norm %v, want %v", mean, want)
+	}
+
+	// Without the L10 of the tree, the coordinates are no longer corrected
+	// for the ones sampled before them.
+	var drop func(*treeNode)
+	drop = func(node *treeNode) {
+		if node.l10 != nil {
+			clear(node.l10)
+			drop(node.left)
+			drop(node.right)
+		}
+	}
+	drop(tree.root)
+	if mean := meanNorm(tree); mean < 1.1*want {
+		t.Errorf("mean squared error norm %v without L10, want above %v", mean, 1.1*want)
+	}
+}
+
+func TestNewFalconTreeInvalid(t *testing.T) {
+	p := Params{Sigma: 15, Sigmin: 1.28, MaxSigma: MAX_SIGMA}
+	g := func(n int, v float64) []complex128 {
+		f := make([]complex128, n)
+		for i := range f {
+			f[i] = complex(v, 0)
+		}
+		return f
+	}
+	for _, tc := range []struct {
+		name          string
+		g00, g01, g11 []complex128
+	}{
+		{"n = 1", g(1, 100), g(1, 0), g(1, 100)},
+		{"n = 3", g(3, 100), g(3, 0), g(3, 100)},
+		{"lengths", g(4, 100), g(2, 0), g(4, 100)},
+		{"leaf too wide", g(4, 49), g(4, 0), g(4, 100)},
+		{"leaf too narrow", g(4, 100), g(4, 0), g(4, 400)},
+	} {
+		if _, err := NewFalconTree(tc.g00, tc.g01, tc.g11, p); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
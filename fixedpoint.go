@@ -0,0 +1,101 @@
+package sampler
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Fixed-point format of the exponent x in WithFixedPointExponent mode: x is
+// a multiple of 2^-expFrac. With |z - r| <= MaxBaseSample() + 2, (z - r)^2
+// stays below 2^10 as long as the table has at most maxFixedBaseSample
+// entries, so it fits in 64 bits with expFrac = 54.
+const expFrac = 54
+
+// maxFixedBaseSample is the longest table, and so the largest base sample
+// z0, supported by the fixed-point exponent: (z0 + 2)^2 < 2^10 keeps both
+// (z - r)^2 and z0^2 below 2^(64-expFrac).
+const maxFixedBaseSample = 29
+
+// ln2Fixed is LN2 in the format of the fixed-point exponent.
+var ln2Fixed = uint64(math.Round(LN2 * (1 << expFrac)))
+
+// WithFixedPointExponent makes the rejection step compute its exponent
+// x = (z - r)^2 / (2 * sigma^2) - z0^2 / (2 * MAX_SIGMA^2), and the reduction
+// x = s * ln(2) + r of BerExp, in 64-bit fixed point instead of float64.
+//
+// The float64 path is only reproducible bit for bit as long as every
+// operation is rounded on its own, but Go allows a multiplication and an
+// addition to be fused into one FMA instruction, as on arm64, ppc64 and
+// s390x, which rounds differently. In this mode the only floating-point
+// operations left are the conversions of r = mu - floor(mu), 1 / (2 * sigma^2)
+// and sigmin / sigma, single correctly rounded operations, to fixed point.
+//
+// x is truncated to a multiple of 2^-54, so the acceptance probability
+// differs from that of the float64 path by a relative 2^-50 or so, and the
+// samples are the same but with a negligible probability. The exp cache of
+// WithExpCache is not used in this mode.
+//
+// The table must have at most 29 entries, which RCDT has, or an error
+// wrapping ErrInvalidSigma is returned, whether WithTable or
+// WithRCDTPrecisionBytes comes before or after this option.
+func WithFixedPointExponent() Option {
+	return func(sp *Sampler) error {
+		sp.fixedPointExponent = true
+		return sp.checkFixedPointTable(len(sp.rcdt))
+	}
+}
+
+// checkFixedPointTable returns an error wrapping ErrInvalidSigma if the
+// exponent is in fixed point and a table of n entries would overflow it.
+func (sp *Sampler) checkFixedPointTable(n int) error {
+	if sp.fixedPointExponent && n > maxFixedBaseSample {
+		return fmt.Errorf("%w: a table of %d entries overflows the fixed-point exponent, which supports %d",
+			ErrInvalidSigma, n, maxFixedBaseSample)
+	}
+	return nil
+}
+
+// berexpThresholdFixed is berexpThreshold for the exponent of a trial with
+// base sample z0 and candidate z, computed in fixed point.
+func (sp *Sampler) berexpThresholdFixed(z, z0 int, r float64, p sigmaParams) (uint64, error) {
+	if !(r >= 0 && r <= 1) || !(p.dss < 1) {
+		return 0, fmt.Errorf("%w: fixed-point exponent out of range for r = %v and sigma = %v", ErrInvalidSigma, r, p.sigma)
+	}
+	x := exponentFixed(z, z0, uint64(r*(1<<expFrac)), uint64(p.dss*(1<<64)), uint64(sp.inv2sigma2*(1<<64)))
+
+	s := x / ln2Fixed
+	rx := x - s*ln2Fixed
+	s = Clamp(s, 0, 63)
+	// rx to the scale of approxexp, 2^-expShift.
+	var zx uint64
+	if sp.expShift >= expFrac {
+		zx = rx << (sp.expShift - expFrac)
+	} else {
+		zx = rx >> (expFrac - sp.expShift)
+	}
+	return threshold(sp.approxexpFixed(zx, p.zccs), s), nil
+}
+
+// exponentFixed returns (z - r)^2 * dss - z0^2 * inv2sigma2, clamped to 0
+// from below, as a multiple of 2^-expFrac. r is given as a multiple of
+// 2^-expFrac in [0, 1], dss and inv2sigma2 as multiples of 2^-64 in [0, 1).
+func exponentFixed(z, z0 int, r, dss, inv2sigma2 uint64) uint64 {
+	var d uint64 // |z - r|
+	switch {
+	case z > 0:
+		d = uint64(z)<<expFrac - r
+	case z == 0:
+		d = r
+	default:
+		d = uint64(-z)<<expFrac + r
+	}
+	hi, lo := bits.Mul64(d, d)
+	sq := hi<<(64-expFrac) | lo>>expFrac // (z - r)^2
+	t1, _ := bits.Mul64(sq, dss)
+	t2, _ := bits.Mul64(uint64(z0*z0)<<expFrac, inv2sigma2)
+	if t1 < t2 {
+		return 0
+	}
+	return t1 - t2
+}
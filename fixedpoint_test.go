@@ -0,0 +1,102 @@
+package sampler
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFixedPointExponent(t *testing.T) {
+	sp, err := NewSamplerWithOptions(nil, WithFixedPointExponent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The exponent and threshold agree with the float64 path on the
+	// inputs met by the KAT vectors.
+	var maxX, maxY float64
+	for _, v := range samplerKATs() {
+		r := v.Mu - math.Floor(v.Mu)
+		p := sp.newSigmaParams(v.Sigma, v.Sigmin)
+		for z0 := 0; z0 <= BaseSamplerMax; z0++ {
+			for b := 0; b < 2; b++ {
+				z := b + (2*b-1)*z0
+				x := math.Pow(float64(z)-r, 2)*p.dss - math.Pow(float64(z0), 2)*inv2sigma2
+				xf := exponentFixed(z, z0, uint64(r*(1<<expFrac)), uint64(p.dss*(1<<64)), uint64(inv2sigma2*(1<<64)))
+				maxX = max(maxX, math.Abs(max(x, 0)-float64(xf)/(1<<expFrac))/max(x, 1))
+
+				th, err := sp.berexpThresholdFixed(z, z0, r, p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := sp.berexpThreshold(max(x, 0), p.ccs)
+				maxY = max(maxY, math.Abs(float64(th)-float64(want))/(1<<64))
+			}
+		}
+	}
+	t.Logf("fixed-point exponent within a relative 2^%.1f, threshold within 2^%.1f", math.Log2(maxX), math.Log2(maxY))
+	if maxX > 0x1p-45 {
+		t.Errorf("fixed-point exponent differs by a relative %g, want <= 2^-45", maxX)
+	}
+	if maxY > 0x1p-45 {
+		t.Errorf("fixed-point threshold differs by %g, want <= 2^-45", maxY)
+	}
+
+	for _, v := range samplerKATs() {
+		sp.SetReader(bytesReader(decodeHexString(v.Octets)))
+		if z := sp.Samplerz(v.Mu, v.Sigma, v.Sigmin); z != v.Z {
+			t.Fatalf("KAT in fixed-point mode: got %d, want %d", z, v.Z)
+		}
+	}
+
+	sp.Reseed(testSeed)
+	for _, mu := range []float64{math.NaN(), math.Inf(1)} {
+		if _, err := sp.SamplerzErr(mu, 1.7, 1.28); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("mu = %v: got %v, want ErrInvalidSigma", mu, err)
+		}
+	}
+	if _, err := sp.SamplerzErr(0.5, 0.5, 0.4); !errors.Is(err, ErrInvalidSigma) {
+		t.Errorf("sigma = 0.5: got %v, want ErrInvalidSigma", err)
+	}
+}
+
+func TestFixedPointTableLimit(t *testing.T) {
+	// The exponent is exact up to the longest supported table.
+	inv2sigma2 := 1 / (2 * MAX_SIGMA * MAX_SIGMA)
+	p := newsampler(nil).newSigmaParams(1.3, 1.28)
+	z0 := maxFixedBaseSample
+	for b := 0; b < 2; b++ {
+		z := b + (2*b-1)*z0
+		for _, r := range []float64{0, 0.5, 1} {
+			x := math.Pow(float64(z)-r, 2)*p.dss - math.Pow(float64(z0), 2)*inv2sigma2
+			xf := exponentFixed(z, z0, uint64(r*(1<<expFrac)), uint64(p.dss*(1<<64)), uint64(inv2sigma2*(1<<64)))
+			if d := math.Abs(max(x, 0)-float64(xf)/(1<<expFrac)) / max(x, 1); d > 0x1p-45 {
+				t.Errorf("z = %d, r = %v: fixed-point exponent differs by a relative %g", z, r, d)
+			}
+		}
+	}
+
+	wide, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wide) <= maxFixedBaseSample {
+		t.Fatalf("table of %d entries, want more than %d", len(wide), maxFixedBaseSample)
+	}
+	for name, opts := range map[string][]Option{
+		"table first":     {WithTable(wide, 3, 80), WithFixedPointExponent()},
+		"table second":    {WithFixedPointExponent(), WithTable(wide, 3, 80)},
+		"precision first": {WithRCDTPrecisionBytes(31), WithFixedPointExponent()},
+		"precision last":  {WithFixedPointExponent(), WithRCDTPrecisionBytes(31)},
+	} {
+		if _, err := NewSamplerWithOptions(nil, opts...); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("%s: got %v, want ErrInvalidSigma", name, err)
+		}
+	}
+	narrow, err := GenerateRCDT(2.5, 72)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSamplerWithOptions(nil, WithFixedPointExponent(), WithTable(narrow, 2.5, 72)); err != nil {
+		t.Errorf("table of %d entries: %v", len(narrow), err)
+	}
+}
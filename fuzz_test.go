@@ -0,0 +1,137 @@
+package sampler
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// FuzzSamplerRandomness uses the fuzzer input as the whole randomness
+// source, so that the fuzzer steers baseSampler and berexp, including the
+// ones in constant-time mode, into every branch. It checks that sampling
+// either fails with ErrRNG once the input is exhausted, or returns a sample
+// close to mu after reading a bounded number of bytes per trial.
+func FuzzSamplerRandomness(f *testing.F) {
+	for _, v := range samplerKATs()[:16] {
+		f.Add(decodeHexString(v.Octets), v.Mu, v.Sigma, v.Sigmin, false)
+	}
+	f.Add([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0}, 0.0, 1.82, 1.28, false)
+	f.Add(make([]byte, 64), -0.5, 1.5, 1.2, true)
+
+	f.Fuzz(func(t *testing.T, octets []byte, mu, sigma, sigmin float64, constantTime bool) {
+		if math.IsNaN(mu) || math.Abs(mu) > 1<<20 {
+			t.Skip("mu out of range")
+		}
+		rr := &recordingReader{r: bytesReader(octets)}
+		sp := newsampler(rr)
+		sp.constantTimeBerExp = constantTime
+		if sp.checkSigma(sigma, sigmin) != nil || isSubnormal(mu) {
+			t.Skip("parameters out of range")
+		}
+
+		z, iter, err := sp.samplerz(mu, sigma, sigmin)
+		if err != nil {
+			if !errors.Is(err, ErrRNG) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		// |z - floor(mu)| <= max(z0 + 1) = len(RCDT) + 1.
+		if d := math.Abs(float64(z) - mu); d > float64(len(RCDT)+2) {
+			t.Fatalf("sample %d is %v away from mu = %v", z, d, mu)
+		}
+		// Each trial reads RCDTprecLen bytes, 1 sign byte and 1 to 8 bytes
+		// in berexp.
+		lo, hi := iter*(int(RCDTprecLen)+2), iter*(int(RCDTprecLen)+9)
+		if n := len(rr.seen); n < lo || n > hi {
+			t.Fatalf("read %d bytes in %d trials, want between %d and %d", n, iter, lo, hi)
+		}
+	})
+}
+
+// FuzzApproxExp checks approxexp over its domain x in [0, ln 2], ccs in
+// [0, 1] against 2^63 · ccs · exp(−x), to within the 2^−47 error bound of
+// the polynomial of the specification.
+func FuzzApproxExp(f *testing.F) {
+	for _, x := range []float64{0, 0.1, 0.5, LN2} {
+		for _, ccs := range []float64{0, 0.5, 0.7, 1} {
+			f.Add(x, ccs)
+		}
+	}
+
+	sp := newsampler(nil)
+	f.Fuzz(func(t *testing.T, x, ccs float64) {
+		if !(0 <= x && x <= LN2) || !(0 <= ccs && ccs <= 1) {
+			t.Skip("out of the domain of approxexp")
+		}
+		y := sp.approxexp(x, ccs)
+		want := new(big.Float).SetFloat64(ccs * math.Exp(-x))
+		want.SetMantExp(want, 63)
+		diff, _ := new(big.Float).Sub(new(big.Float).SetUint64(y), want).Float64()
+		if math.Abs(diff) > 0x1p16 {
+			t.Fatalf("approxexp(%v, %v) = %#x, off by %v from 2^63 · ccs · exp(−x)", x, ccs, y, diff)
+		}
+	})
+}
+
+// FuzzBerExp uses the fuzzer input as the bytes drawn by berexp, and checks
+// the threshold against the math/big reference and the decision against the
+// comparison of the 64-bit uniform with it, in both the early-exit and the
+// constant-time modes.
+func FuzzBerExp(f *testing.F) {
+	f.Add(0.0, 1.0, []byte{0xff, 0, 0, 0, 0, 0, 0, 0})
+	f.Add(0.3, 0.75, []byte{0x5f})
+	f.Add(44.0, 1.0, []byte{0, 0, 0, 0, 0, 0, 0, 0})
+	f.Add(1000.0, 0.5, []byte{0, 0, 0, 0, 0, 0, 0, 1})
+
+	f.Fuzz(func(t *testing.T, x, ccs float64, octets []byte) {
+		if !(0 <= x && x <= 1<<20) || !(0 <= ccs && ccs <= 1) {
+			t.Skip("parameters out of range")
+		}
+		sp := newsampler(nil)
+		threshold := sp.berexpThreshold(x, ccs)
+		if want := berexpThresholdRef(x, ccs); threshold != want {
+			t.Fatalf("threshold(%v, %v) = %#x, want %#x", x, ccs, threshold, want)
+		}
+
+		// The uniform is drawn most significant byte first, and stops at
+		// the first byte that differs from the threshold.
+		var u [8]byte
+		copy(u[:], octets)
+		want := binary.BigEndian.Uint64(u[:]) < threshold
+		var need int
+		for need < 8 && u[need] == byte(threshold>>(56-8*need)) {
+			need++
+		}
+		need = min(need+1, 8)
+
+		rr := &recordingReader{r: bytesReader(octets)}
+		sp.SetReader(rr)
+		accept, err := sp.berexp(x, ccs)
+		switch {
+		case len(octets) < need:
+			if !errors.Is(err, ErrRNG) {
+				t.Fatalf("%d of %d bytes: got %v, want ErrRNG", len(octets), need, err)
+			}
+		case err != nil:
+			t.Fatal(err)
+		case accept != want || len(rr.seen) != need:
+			t.Fatalf("got %v after %d bytes, want %v after %d", accept, len(rr.seen), want, need)
+		}
+
+		sp.SetReader(bytesReader(octets))
+		accept, err = sp.berexpCT(x, ccs)
+		switch {
+		case len(octets) < 8:
+			if !errors.Is(err, ErrRNG) {
+				t.Fatalf("constant time, %d bytes: got %v, want ErrRNG", len(octets), err)
+			}
+		case err != nil:
+			t.Fatal(err)
+		case accept != want:
+			t.Fatalf("constant time: got %v, want %v", accept, want)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package sampler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KATEntry is a SamplerZ known answer test: drawing from the randomness
+// Octets, Samplerz(Mu, Sigma, Sigmin) must return Z.
+type KATEntry struct {
+	Count             int
+	Mu, Sigma, Sigmin float64
+	Octets            []byte
+	Z                 int
+}
+
+// ParseFalconKAT reads SamplerZ test vectors in the .rsp format of the NIST
+// KAT files: entries of "key = value" lines, each starting with a count line
+// and separated by blank lines, with "#" comments and "[...]" section
+// headers. The sampler fields are mu, sigma, sigmin, octets (hexadecimal)
+// and z. Other keys, such as the seed, msg, pk, sk and sm of the signing
+// vectors, are ignored, and so are entries without all sampler fields.
+func ParseFalconKAT(r io.Reader) ([]KATEntry, error) {
+	var (
+		entries []KATEntry
+		cur     KATEntry
+		seen    map[string]bool
+	)
+	flush := func() {
+		if seen["mu"] && seen["sigma"] && seen["sigmin"] && seen["octets"] && seen["z"] {
+			entries = append(entries, cur)
+		}
+		cur, seen = KATEntry{}, nil
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<24) // signing vectors have long lines
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "[") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("sampler: KAT line %d: missing '='", line)
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key == "count" {
+			flush()
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		var err error
+		switch key {
+		case "count":
+			cur.Count, err = strconv.Atoi(value)
+		case "mu":
+			cur.Mu, err = strconv.ParseFloat(value, 64)
+		case "sigma":
+			cur.Sigma, err = strconv.ParseFloat(value, 64)
+		case "sigmin":
+			cur.Sigmin, err = strconv.ParseFloat(value, 64)
+		case "octets":
+			cur.Octets, err = hex.DecodeString(value)
+		case "z":
+			cur.Z, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sampler: KAT line %d: %s: %w", line, key, err)
+		}
+		seen[key] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return entries, nil
+}
+
+// RunKAT checks the sampler against entries, and reports the first entry
+// for which it returns another sample, or fails.
+func RunKAT(entries []KATEntry) error {
+	for _, e := range entries {
+		sp := NewSamplerFromBytes(e.Octets)
+		z, err := sp.SamplerzErr(e.Mu, e.Sigma, e.Sigmin)
+		if err != nil {
+			return fmt.Errorf("sampler: KAT %d: %w", e.Count, err)
+		}
+		if z != e.Z {
+			return fmt.Errorf("sampler: KAT %d: got %d, want %d", e.Count, z, e.Z)
+		}
+	}
+	return nil
+}
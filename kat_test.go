@@ -0,0 +1,77 @@
+package sampler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const katExcerpt = `# Falcon-512 SamplerZ
+
+[sampler]
+count = 0
+mu = -91.90471153063714
+sigma = 1.7037990414754918
+sigmin = 1.2778336969128337
+octets = 0FC5442FF043D66E91D1EACAC64EA5450A22941EDC6C
+z = -92
+
+count = 1
+mu = -8.322564895434937
+sigma = 1.7037990414754918
+sigmin = 1.2778336969128337
+octets = F4DA0F8D8444D1A77265C2EF6F98BBBB4BEE7DB8D9B3
+z = -8
+
+count = 2
+seed = 061550234D158C5EC95595FE04EF7A25767F2E24CC2BC479D09D86DC9ABCFDE7
+mlen = 33
+msg = D81C4D8D734FCBFBEADE3D3F8A039FAA2A2C9957E835AD55B22E75BF57BB556AC8
+
+count = 3
+mu = -19.096516109216804
+sigma = 1.7035823083824078
+sigmin = 1.2778336969128334
+octets = DB47F6D7FB9B19F25C36D6B9334D477A8BC0BE68145D
+z = -20
+`
+
+func TestParseFalconKAT(t *testing.T) {
+	entries, err := ParseFalconKAT(strings.NewReader(katExcerpt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The signing vector 2 has no sampler fields.
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	if e := entries[2]; e.Count != 3 || e.Mu != -19.096516109216804 || e.Z != -20 || len(e.Octets) != 22 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if err := RunKAT(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	entries[1].Z++
+	if err := RunKAT(entries); err == nil {
+		t.Error("RunKAT passed with a wrong answer")
+	}
+	entries[1].Z--
+	entries[1].Octets = entries[1].Octets[:5]
+	if err := RunKAT(entries); !errors.Is(err, ErrRNG) {
+		t.Errorf("RunKAT with short octets: got %v, want ErrRNG", err)
+	}
+}
+
+func TestParseFalconKATInvalid(t *testing.T) {
+	for _, in := range []string{
+		"count = 0\nmu -1.5\n",
+		"count = zero\n",
+		"count = 0\nsigma = 1.7.1\n",
+		"count = 0\noctets = 0FC\n",
+	} {
+		if _, err := ParseFalconKAT(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
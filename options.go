@@ -0,0 +1,201 @@
+package sampler
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Option configures a Sampler built by NewSamplerWithOptions.
+type Option func(*Sampler) error
+
+// NewSamplerWithOptions returns a sampler reading its randomness from rng and
+// configured by opts, applied in order. It fails if any option is invalid.
+func NewSamplerWithOptions(rng io.Reader, opts ...Option) (*Sampler, error) {
+	sp := newsampler(rng)
+	for _, opt := range opts {
+		if err := opt(sp); err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+// WithApproxExpScale sets the fixed-point scale used by approxexp, which
+// computes on multiples of 1/scale instead of 2^-63. The coefficients of C are
+// rescaled accordingly. A smaller scale such as 2^31 trades precision of the
+// acceptance probability for cheaper arithmetic; it is meant for research on
+// that tradeoff and departs from the specification.
+//
+// The scale must be a power of two between 2 and 2^63 (the default).
+func WithApproxExpScale(scale uint64) Option {
+	return func(sp *Sampler) error {
+		if scale < 2 || scale&(scale-1) != 0 {
+			return errors.New("sampler: approxexp scale must be a power of two in [2, 2^63]")
+		}
+		shift := uint(bits.TrailingZeros64(scale))
+		sp.expShift = shift
+		sp.expScale = float64(scale)
+		sp.expC = scaledC(shift)
+		return nil
+	}
+}
+
+// WithReadTimeout bounds every read from the randomness source by d. This is
+// meant for sources such as pipes or network connections, where a slow writer
+// would otherwise block sampling indefinitely. A read that times out fails
+// with an error wrapping both ErrRNG and os.ErrDeadlineExceeded. Since the
+// timed out read cannot be cancelled, the sampler must not be used with the
+// same source afterwards.
+//
+// Each bounded read allocates, so this should not be used with fast
+// in-memory sources.
+func WithReadTimeout(d time.Duration) Option {
+	return func(sp *Sampler) error {
+		if d <= 0 {
+			return errors.New("sampler: read timeout must be positive")
+		}
+		sp.readTimeout = d
+		return nil
+	}
+}
+
+// WithReadBuffer makes the sampler read its randomness in blocks of up to
+// size bytes and serve its small reads from them, which saves most calls to
+// the source. For instance 72 bytes hold 8 base sampler draws. The bytes are
+// consumed in the same order, so the samples are the same as without a buffer.
+//
+// The source is however read ahead of what the sampler has used, by up to
+// size bytes: code that inspects the position of the source, such as a
+// counting wrapper, observes the buffered reads.
+func WithReadBuffer(size int) Option {
+	return func(sp *Sampler) error {
+		if size <= 0 {
+			return errors.New("sampler: read buffer size must be positive")
+		}
+		sp.readBuffer = size
+		sp.rng.Store(sp.newSource(sp.rng.Load().r))
+		return nil
+	}
+}
+
+// WithMaxAbsTracker makes the sampler keep in *max the largest offset
+// |z - round(mu)| of the samples it returns, with round as in SamplerzOffset.
+// For valid Falcon parameters the offset stays small, so a large value flags
+// an anomaly; it also bounds the size of encoded coefficients. *max is only
+// ever increased, and is not safe for concurrent access.
+func WithMaxAbsTracker(max *int) Option {
+	return func(sp *Sampler) error {
+		if max == nil {
+			return errors.New("sampler: nil max tracker")
+		}
+		sp.maxAbs = max
+		return nil
+	}
+}
+
+// WithTrialHook makes the sampler call onTrial after every trial of the
+// rejection loop, accepted or not, with the base sample z0, the sign bit b,
+// the candidate offset z = b + (2b - 1) z0 from floor(mu), the exponent x of
+// BerExp and its outcome, e.g. to diagnose acceptance rates. x is computed in
+// floating point also with WithFixedPointExponent. The hook sees values that
+// depend on the secret center, and is meant for debugging only.
+func WithTrialHook(onTrial func(z0, b int, z, x float64, accepted bool)) Option {
+	return func(sp *Sampler) error {
+		if onTrial == nil {
+			return errors.New("sampler: nil trial hook")
+		}
+		sp.onTrial = onTrial
+		return nil
+	}
+}
+
+// WithAdaptiveRejectionCap bounds the rejection loop of each sample to
+// multiplier times ExpectedIterations(sigma, sigmin), rounded up, so that the
+// cap follows the distribution rather than being a single global count. A
+// sample still rejected at the cap fails with ErrRejectionExhausted. The
+// multiplier must be at least 1; for valid parameters a multiplier of 16
+// makes a spurious failure less likely than 2^-30.
+func WithAdaptiveRejectionCap(multiplier float64) Option {
+	return func(sp *Sampler) error {
+		if !(multiplier >= 1) || math.IsInf(multiplier, 0) {
+			return errors.New("sampler: rejection cap multiplier must be finite and at least 1")
+		}
+		sp.rejectionMult = multiplier
+		return nil
+	}
+}
+
+// WithConstantTimeBerExp makes the rejection step use a Bernoulli trial that
+// always draws and compares 8 bytes, instead of stopping at the first byte
+// that differs from the threshold. This closes the timing channel of the
+// early exit, see berexpCT. The acceptance decisions are the same, but since
+// the randomness is consumed differently, the samples no longer follow the
+// KAT vectors.
+func WithConstantTimeBerExp() Option {
+	return func(sp *Sampler) error {
+		sp.constantTimeBerExp = true
+		return sp.checkExpCacheConstantTime()
+	}
+}
+
+// WithConstantTime combines WithConstantTimeBaseSampler and
+// WithConstantTimeBerExp, so that neither the base sampler nor the Bernoulli
+// trials branch on, or stop early depending on, secret values. It does not
+// make the whole trial constant time: the sign is applied without branches,
+// but the exponent and the BerExp threshold go through math.Floor,
+// math.Pow and clamps of secret values, or, with WithFixedPointExponent,
+// the branches of the fixed-point exponent. The number of trials still
+// varies, as in any rejection sampler, but it is independent of the sample
+// returned and, up to a negligible bias, of the center, see
+// ExpectedIterations. As with WithConstantTimeBerExp, the samples no longer
+// follow the KAT vectors.
+//
+// WithConstantTime, like either of the options it combines, cannot be
+// combined with WithExpCache, whose lookups hit or miss depending on the
+// secret values: the options give an error in either order.
+func WithConstantTime() Option {
+	return func(sp *Sampler) error {
+		sp.constantTimeBaseSampler = true
+		sp.constantTimeBerExp = true
+		return sp.checkExpCacheConstantTime()
+	}
+}
+
+// WithBaseSamplerInclusive makes the base sampler count the table entries
+// greater than or equal to the uniform value, instead of strictly greater.
+// The two only differ when the uniform value is exactly one of the entries,
+// which happens with probability 2^-72 per entry.
+//
+// This is a hook for research on the bias at the table boundaries: the
+// inclusive comparison is NOT compliant with the specification.
+func WithBaseSamplerInclusive() Option {
+	return func(sp *Sampler) error {
+		sp.baseSamplerInclusive = true
+		return nil
+	}
+}
+
+// WithLittleEndianBaseSampler makes the base sampler read its uniform value
+// little-endian, to match harnesses that feed the random bits in that order.
+// The specification, and the default, read it big-endian; the other draws of
+// Samplerz are single bytes or, in BerExp, compared byte by byte, and are not
+// affected.
+func WithLittleEndianBaseSampler() Option {
+	return func(sp *Sampler) error {
+		sp.littleEndianBase = true
+		return nil
+	}
+}
+
+// WithConstantTimeBaseSampler makes the base sampler compare the uniform
+// value with every table entry without branching on the result, see
+// baseSamplerCT. The samples are the same as with the default base sampler.
+func WithConstantTimeBaseSampler() Option {
+	return func(sp *Sampler) error {
+		sp.constantTimeBaseSampler = true
+		return sp.checkExpCacheConstantTime()
+	}
+}
@@ -0,0 +1,676 @@
+package sampler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/holiman/uint256"
+)
+
+// approxexpHardcoded is approxexp as written before the scale was made
+// configurable, returning 2^63 · ccs · exp(−x) as in the specification.
+func approxexpHardcoded(x, ccs float64) uint64 {
+	y := new(uint256.Int).Set(C[0])
+	z := new(uint256.Int).SetUint64(uint64(x * (1 << 63)))
+	for _, elt := range C[1:] {
+		y.Mul(y, z)
+		y.Rsh(y, 63)
+		y.Sub(elt, y)
+	}
+	z.SetUint64(uint64(ccs * (1 << 63)))
+	y.Mul(z, y)
+	y.Rsh(y, 63)
+	return y.Uint64()
+}
+
+// approxexpUint256 is approxexp as computed with uint256 before it moved to
+// bits.Mul64, at the scale 2^shift.
+func approxexpUint256(x, ccs float64, shift uint) uint64 {
+	scale := float64(uint64(1) << shift)
+	y := new(uint256.Int).Rsh(C[0], 63-shift)
+	z := new(uint256.Int).SetUint64(uint64(x * scale))
+	for _, elt := range C[1:] {
+		y.Mul(y, z)
+		y.Rsh(y, shift)
+		y.Sub(new(uint256.Int).Rsh(elt, 63-shift), y)
+	}
+	z.SetUint64(uint64(ccs * scale))
+	y.Mul(z, y)
+	y.Rsh(y, shift)
+	return y.Uint64() << (63 - shift)
+}
+
+func TestApproxExpUint64(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, shift := range []uint{63, 52, 31, 16} {
+		sp, err := NewSamplerWithOptions(nil, WithApproxExpScale(1<<shift))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(x, ccs float64) {
+			if got, want := sp.approxexp(x, ccs), approxexpUint256(x, ccs, shift); got != want {
+				t.Fatalf("scale 2^%d: approxexp(%v, %v) = %#x, want %#x", shift, x, ccs, got, want)
+			}
+		}
+		for _, x := range []float64{0, math.SmallestNonzeroFloat64, LN2 / 2, math.Nextafter(LN2, 0), LN2} {
+			for _, ccs := range []float64{0, 0.5, math.Nextafter(1, 0), 1} {
+				check(x, ccs)
+			}
+		}
+		for i := 0; i < 100000; i++ {
+			check(rng.Float64()*LN2, rng.Float64())
+		}
+	}
+}
+
+func TestApproxExpDefaultScale(t *testing.T) {
+	explicit, err := NewSamplerWithOptions(nil, WithApproxExpScale(1<<63))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sp := range []*Sampler{newsampler(nil), explicit} {
+		for i := 0; i <= 1000; i++ {
+			x := LN2 * float64(i) / 1000
+			for j := 0; j < 100; j++ {
+				ccs := float64(j) / 100
+				if got, want := sp.approxexp(x, ccs), approxexpHardcoded(x, ccs); got != want {
+					t.Fatalf("approxexp(%v, %v) = %#x, want %#x", x, ccs, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestApproxExpScale31(t *testing.T) {
+	sp, err := NewSamplerWithOptions(nil, WithApproxExpScale(1<<31))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 1000; i++ {
+		x := LN2 * float64(i) / 1000
+		for j := 1; j < 100; j++ {
+			ccs := float64(j) / 100
+			got, want := sp.approxexp(x, ccs), approxexpHardcoded(x, ccs)
+			if d := math.Abs(float64(got) - float64(want)); d > 0x1p-26*0x1p64 {
+				t.Fatalf("approxexp(%v, %v) = %#x at scale 2^31, want about %#x", x, ccs, got, want)
+			}
+		}
+	}
+}
+
+func TestApproxExpScaleInvalid(t *testing.T) {
+	for _, scale := range []uint64{0, 1, 3, 1<<62 + 1, math.MaxUint64} {
+		if _, err := NewSamplerWithOptions(nil, WithApproxExpScale(scale)); err == nil {
+			t.Errorf("scale %#x: expected an error", scale)
+		}
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+
+	sp, err := NewSamplerWithOptions(pr, WithReadTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only part of a base sampler draw ever arrives.
+	if _, err := pw.Write([]byte{0x42, 0x42}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = sp.SamplerzErr(0, 1.5, 1.28)
+	if !errors.Is(err, ErrRNG) || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("got error %v, want a timeout wrapping ErrRNG", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timeout fired after %v", elapsed)
+	}
+}
+
+func TestReadTimeoutShortReads(t *testing.T) {
+	v := samplerKATunmarshal([]byte(`[{
+		"mu":-11.335543982423326,
+		"sigma":1.7035823083824078,
+		"sigmin":1.2778336969128334,
+		"octets":"AE41B4F5209665C74D00DCC1A8168A7BB516B3190CB42C1DED26CD52AED770ECA7DD334E0547BCC3C163CE0B",
+		"z":-12
+	}]`))[0]
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	go func() {
+		defer pw.Close()
+		// A slow writer delivering one byte at a time forces short reads.
+		for _, c := range decodeHexString(v.Octets) {
+			time.Sleep(time.Millisecond)
+			if _, err := pw.Write([]byte{c}); err != nil {
+				return
+			}
+		}
+	}()
+
+	sp, err := NewSamplerWithOptions(pr, WithReadTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z != v.Z {
+		t.Fatalf("got %d, want %d", z, v.Z)
+	}
+}
+
+func TestReadTimeoutInvalid(t *testing.T) {
+	if _, err := NewSamplerWithOptions(nil, WithReadTimeout(0)); err == nil {
+		t.Fatal("expected an error for a zero timeout")
+	}
+}
+
+func TestReadBuffer(t *testing.T) {
+	for _, size := range []int{1, 5, int(RCDTprecLen), 8 * int(RCDTprecLen), 512} {
+		buffered, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithReadBuffer(size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diffSamplers(t, newsampler(fromSeedSHAKE(testSeed)), buffered, 20000)
+
+		buffered.Reseed(testSeed)
+		diffSamplers(t, newsampler(fromSeedSHAKE(testSeed)), buffered, 1000)
+	}
+}
+
+func TestReadBufferKAT(t *testing.T) {
+	// A KAT provides exactly the bytes Samplerz needs, so the buffer must
+	// never require more than that.
+	for _, v := range samplerKATs() {
+		sp, err := NewSamplerWithOptions(bytesReader(decodeHexString(v.Octets)), WithReadBuffer(8*int(RCDTprecLen)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z != v.Z {
+			t.Fatalf("expected %d, got %d", v.Z, z)
+		}
+	}
+}
+
+func BenchmarkSamplerzReadBuffer(b *testing.B) {
+	mu := 217.87844009133536
+	sigma := 1.3052985443865464
+	sigmin := 1.298280334344292
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithReadBuffer(8*int(RCDTprecLen)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < b.N; i++ {
+		sp.Samplerz(mu, sigma, sigmin)
+	}
+}
+
+// onlyReader hides all methods of its reader but Read.
+type onlyReader struct{ io.Reader }
+
+func TestByteReaderSource(t *testing.T) {
+	for _, v := range samplerKATs() {
+		octets := decodeHexString(v.Octets)
+		sp := newsampler(bufio.NewReader(bytesReader(octets)))
+		if z, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin); err != nil || z != v.Z {
+			t.Fatalf("got %d, %v, want %d", z, err, v.Z)
+		}
+		// Every truncation of the stream fails as without ReadByte.
+		for n := 0; n < len(octets); n += 3 {
+			_, err := newsampler(bytes.NewReader(octets[:n])).SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+			_, want := newsampler(onlyReader{bytes.NewReader(octets[:n])}).SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+			if err == nil || err.Error() != want.Error() {
+				t.Fatalf("%d of %d bytes: got %v, want %v", n, len(octets), err, want)
+			}
+		}
+	}
+}
+
+func BenchmarkSamplerzByteReader(b *testing.B) {
+	mu := 217.87844009133536
+	sigma := 1.3052985443865464
+	sigmin := 1.298280334344292
+	for _, bc := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{"ReadByte", bufio.NewReader(fromSeedSHAKE(testSeed))},
+		{"Read", onlyReader{bufio.NewReader(fromSeedSHAKE(testSeed))}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			sp := newsampler(bc.r)
+			for i := 0; i < b.N; i++ {
+				sp.Samplerz(mu, sigma, sigmin)
+			}
+		})
+	}
+}
+
+func TestTrialHook(t *testing.T) {
+	const sigma, sigmin = 1.7, 1.28
+	for _, fixed := range []bool{false, true} {
+		type trial struct {
+			z0, b    int
+			z, x     float64
+			accepted bool
+		}
+		var trials []trial
+		opts := []Option{WithTrialHook(func(z0, b int, z, x float64, accepted bool) {
+			trials = append(trials, trial{z0, b, z, x, accepted})
+		})}
+		if fixed {
+			opts = append(opts, WithFixedPointExponent())
+		}
+		sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := newsampler(fromSeedSHAKE(testSeed))
+
+		var total, accepted int
+		var rate float64 // sum of the acceptance probabilities ccs * exp(-x)
+		for i := 0; i < 20000; i++ {
+			mu := float64(i)/97 - 50
+			trials = trials[:0]
+			z, iter := sp.SamplerzWithStats(mu, sigma, sigmin)
+			if want := ref.Samplerz(mu, sigma, sigmin); z != want {
+				t.Fatalf("sample %d: got %d, want %d", i, z, want)
+			}
+			if len(trials) != iter || !trials[iter-1].accepted {
+				t.Fatalf("sample %d: %d trials reported for %d iterations", i, len(trials), iter)
+			}
+			for j, tr := range trials {
+				r := mu - math.Floor(mu)
+				x := (tr.z-r)*(tr.z-r)/(2*sigma*sigma) - float64(tr.z0*tr.z0)*inv2sigma2
+				if tr.z != float64(tr.b+(2*tr.b-1)*tr.z0) || math.Abs(tr.x-x) > 1e-9 || tr.accepted != (j == iter-1) {
+					t.Fatalf("sample %d, trial %d: got %+v", i, j, tr)
+				}
+				total++
+				rate += sigmin / sigma * math.Exp(-tr.x)
+				if tr.accepted {
+					accepted++
+				}
+			}
+			if z != int(math.Floor(mu))+int(trials[iter-1].z) {
+				t.Fatalf("sample %d: %d is not floor(mu) + z", i, z)
+			}
+		}
+		// The acceptance rate of BerExp is ccs * exp(-x).
+		if got, want := float64(accepted), rate; math.Abs(got-want) > 4*math.Sqrt(want) {
+			t.Errorf("fixed point %v: %v trials accepted, want about %v", fixed, got, want)
+		}
+	}
+}
+
+func TestMaxAbsTracker(t *testing.T) {
+	// A zero uniform makes the base sampler return its maximum, 18; with the
+	// sign bit set and zero BerExp bytes the first sample is 19.
+	extreme := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0}
+	rng := io.MultiReader(bytesReader(extreme), fromSeedSHAKE(testSeed))
+
+	var tracked int
+	sp, err := NewSamplerWithOptions(rng, WithMaxAbsTracker(&tracked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want int
+	for i := 0; i < 2000; i++ {
+		mu := float64(i) * 0.1
+		z := sp.Samplerz(mu, 1.82, 1.28)
+		if i == 0 && z != 19 {
+			t.Fatalf("the crafted extreme sample is %d, want 19", z)
+		}
+		want = max(want, abs(z-roundCenter(mu)))
+		if tracked != want {
+			t.Fatalf("sample %d: tracked %d, want %d", i, tracked, want)
+		}
+	}
+}
+
+func TestAdaptiveRejectionCap(t *testing.T) {
+	const multiplier = 16
+	for _, p := range []struct{ sigma, sigmin float64 }{
+		{1.7037990414754918, 1.2778336969128337},
+		{1.3052985443865464, 1.298280334344292},
+		{1.8, 1.1},
+	} {
+		sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithAdaptiveRejectionCap(multiplier))
+		if err != nil {
+			t.Fatal(err)
+		}
+		limit := int(math.Ceil(multiplier * ExpectedIterations(p.sigma, p.sigmin)))
+		var observed int
+		for i := 0; i < 100000; i++ {
+			_, iter, err := sp.samplerz(float64(i)/7, p.sigma, p.sigmin)
+			if err != nil {
+				t.Fatalf("sigma %v: %v", p.sigma, err)
+			}
+			observed = max(observed, iter)
+		}
+		// Over 1e5 samples the longest run of rejections stays far from the cap,
+		// whose failure probability is about 2^-30 per sample.
+		if observed+8 > limit {
+			t.Errorf("sigma %v: cap %d is not comfortably above the %d iterations observed", p.sigma, limit, observed)
+		}
+	}
+}
+
+func TestAdaptiveRejectionCapExhausted(t *testing.T) {
+	// With all bytes set, BerExp compares 0xFF against bytes of z that are
+	// smaller and rejects every time.
+	rng := bytesReader(bytes.Repeat([]byte{0xFF}, 1<<12))
+	sp, err := NewSamplerWithOptions(rng, WithAdaptiveRejectionCap(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, iter, err := sp.samplerz(0, 1.7037990414754918, 1.2778336969128337)
+	if !errors.Is(err, ErrRejectionExhausted) {
+		t.Fatalf("got %v, want ErrRejectionExhausted", err)
+	}
+	if want := int(math.Ceil(4 * ExpectedIterations(1.7037990414754918, 1.2778336969128337))); iter != want {
+		t.Fatalf("gave up after %d iterations, want %d", iter, want)
+	}
+}
+
+func TestAdaptiveRejectionCapInvalid(t *testing.T) {
+	for _, m := range []float64{0, 0.5, -1, math.NaN(), math.Inf(1)} {
+		if _, err := NewSamplerWithOptions(nil, WithAdaptiveRejectionCap(m)); err == nil {
+			t.Errorf("multiplier %v: expected an error", m)
+		}
+	}
+}
+
+func TestConstantTimeBerExp(t *testing.T) {
+	sp, err := NewSamplerWithOptions(nil, WithConstantTimeBerExp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := fromSeedSHAKE(testSeed)
+	decide := func(f func(x, ccs float64) (bool, error), x, ccs float64, b []byte) bool {
+		sp.rng.Store(sp.newSource(bytesReader(b)))
+		accept, err := f(x, ccs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accept
+	}
+
+	// The inputs of berexp met while sampling the KAT vectors, for every
+	// value of the base sample.
+	for _, v := range samplerKATs() {
+		r := v.Mu - math.Floor(v.Mu)
+		dss := 1 / (2 * v.Sigma * v.Sigma)
+		ccs := v.Sigmin / v.Sigma
+		for z0 := 0; z0 < len(RCDT); z0++ {
+			for b := 0; b < 2; b++ {
+				z := float64(b + (2*b-1)*z0)
+				x := math.Pow(z-r, 2)*dss - math.Pow(float64(z0), 2)*inv2sigma2
+				threshold := sp.berexpThreshold(x, ccs)
+
+				// Uniform bytes, and bytes matching the threshold on a
+				// prefix, to exercise every exit of berexp.
+				for k := 0; k <= 8; k++ {
+					buf := make([]byte, 9)
+					if _, err := rng.Read(buf); err != nil {
+						t.Fatal(err)
+					}
+					for i := 0; i < k; i++ {
+						buf[i] = byte(threshold >> (56 - 8*i))
+					}
+					want := decide(sp.berexp, x, ccs, buf)
+					if got := decide(sp.berexpCT, x, ccs, buf[:8]); got != want {
+						t.Fatalf("berexpCT(%v, %v) on %x = %v, want %v", x, ccs, buf, got, want)
+					}
+				}
+			}
+		}
+	}
+
+	sp.Reseed(testSeed)
+	for i := 0; i < 1000; i++ {
+		if _, err := sp.SamplerzErr(float64(i)/7, 1.7037990414754918, 1.2778336969128337); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBaseSamplerInclusive(t *testing.T) {
+	// Both use the table of the specification, whose entries are distinct.
+	table := specRCDT(t)
+	strict, err := NewSamplerWithOptions(nil, WithTable(table, 1.8205, RCDTprec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inclusive, err := NewSamplerWithOptions(nil, WithTable(table, 1.8205, RCDTprec), WithBaseSamplerInclusive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseSample := func(sp *Sampler, u []byte) int {
+		sp.rng.Store(sp.newSource(bytesReader(u)))
+		z0, err := sp.baseSampler()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return z0
+	}
+
+	// A uniform value equal to table[i] is below the i entries before it.
+	for i, elt := range table {
+		u := make([]byte, RCDTprecLen)
+		elt.WriteToSlice(u)
+		if got := baseSample(strict, u); got != i {
+			t.Errorf("strict base sample of table[%d] = %d, want %d", i, got, i)
+		}
+		if got := baseSample(inclusive, u); got != i+1 {
+			t.Errorf("inclusive base sample of table[%d] = %d, want %d", i, got, i+1)
+		}
+	}
+
+	rng := fromSeedSHAKE(testSeed)
+	for i := 0; i < 10000; i++ {
+		u := make([]byte, RCDTprecLen)
+		if _, err := rng.Read(u); err != nil {
+			t.Fatal(err)
+		}
+		if a, b := baseSample(strict, u), baseSample(inclusive, u); a != b {
+			t.Fatalf("base samples of %x differ: %d strict, %d inclusive", u, a, b)
+		}
+	}
+}
+
+func TestLittleEndianBaseSampler(t *testing.T) {
+	le, err := NewSamplerWithOptions(nil, WithLittleEndianBaseSampler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	leCT, err := NewSamplerWithOptions(nil, WithLittleEndianBaseSampler(), WithConstantTimeBaseSampler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	be := newsampler(nil)
+	baseSample := func(sp *Sampler, u []byte) int {
+		sp.rng.Store(sp.newSource(bytesReader(u)))
+		z0, err := sp.BaseSamplerErr()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return z0
+	}
+
+	// RCDT[i] - 1 written in either order is below the entries up to i.
+	for i, elt := range RCDT {
+		u := make([]byte, RCDTprecLen)
+		new(uint256.Int).SubUint64(elt, 1).WriteToSlice(u)
+		rev := slices.Clone(u)
+		slices.Reverse(rev)
+		if got := baseSample(be, u); got != i+1 {
+			t.Errorf("big-endian base sample of RCDT[%d] - 1 = %d, want %d", i, got, i+1)
+		}
+		for _, sp := range []*Sampler{le, leCT} {
+			if got := baseSample(sp, rev); got != i+1 {
+				t.Errorf("little-endian base sample of RCDT[%d] - 1 = %d, want %d", i, got, i+1)
+			}
+		}
+	}
+	// A last byte of 0xff is the low byte big-endian, below all but the last
+	// entries, and the high byte little-endian, above all of them.
+	u := make([]byte, RCDTprecLen)
+	u[len(u)-1] = 0xff
+	if got := baseSample(le, u); got != 0 {
+		t.Errorf("little-endian base sample of %x = %d, want 0", u, got)
+	}
+	var want int
+	for _, elt := range RCDT {
+		if elt.GtUint64(0xff) {
+			want++
+		}
+	}
+	if got := baseSample(be, u); got != want || want < len(RCDT)-2 {
+		t.Errorf("big-endian base sample of %x = %d, want %d", u, got, want)
+	}
+}
+
+func TestConstantTime(t *testing.T) {
+	r := &tracingReader{r: fromSeedSHAKE(testSeed)}
+	sp, err := NewSamplerWithOptions(r, WithConstantTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithConstantTimeBaseSampler(), WithConstantTimeBerExp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		mu := float64(i)/11 - 90
+		r.reads = r.reads[:0]
+		z, iterations := sp.SamplerzWithStats(mu, 1.7, 1.28)
+		if want := ref.Samplerz(mu, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+		// Every trial draws the same bytes, whatever their values.
+		if len(r.reads) != 3*iterations {
+			t.Fatalf("sample %d: %d reads for %d trials", i, len(r.reads), iterations)
+		}
+		for k := 0; k < len(r.reads); k += 3 {
+			if r.reads[k] != int(RCDTprecLen) || r.reads[k+1] != 1 || r.reads[k+2] != 8 {
+				t.Fatalf("sample %d: trial reads %v", i, r.reads[k:k+3])
+			}
+		}
+	}
+
+	// The branchless threshold.
+	for _, y := range []uint64{0, 1, 2, 1 << 62, 1 << 63} {
+		for _, s := range []uint64{0, 1, 17, 63} {
+			want := uint64(0)
+			if y != 0 {
+				want = (2*y - 1) >> s
+			}
+			if got := threshold(y, s); got != want {
+				t.Errorf("threshold(%#x, %d) = %#x, want %#x", y, s, got, want)
+			}
+		}
+	}
+
+	// The exp cache is rejected with any constant-time option, in either
+	// order.
+	for _, opts := range [][]Option{
+		{WithConstantTime(), WithExpCache(64)},
+		{WithExpCache(64), WithConstantTime()},
+		{WithConstantTimeBerExp(), WithExpCache(64)},
+		{WithExpCache(64), WithConstantTimeBerExp()},
+		{WithConstantTimeBaseSampler(), WithExpCache(64)},
+		{WithExpCache(64), WithConstantTimeBaseSampler()},
+	} {
+		if _, err := NewSamplerWithOptions(nil, opts...); !errors.Is(err, errConstantTimeExpCache) {
+			t.Errorf("constant time with an exp cache: got %v, want errConstantTimeExpCache", err)
+		}
+	}
+}
+
+func TestConstantTimeBaseSampler(t *testing.T) {
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		opts      []Option
+		table     []*uint256.Int
+		precBytes int
+	}{
+		{"default", nil, RCDT, int(RCDTprecLen)},
+		{"inclusive", []Option{WithBaseSamplerInclusive()}, RCDT, int(RCDTprecLen)},
+		{"80-bit table", []Option{WithTable(table, 3, 80)}, table, 10},
+	} {
+		sp, err := NewSamplerWithOptions(nil, tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs := [][]byte{}
+		for _, elt := range tc.table {
+			for _, d := range []uint64{0, 1} {
+				for _, add := range []bool{false, true} {
+					u := new(uint256.Int).Set(elt)
+					if add {
+						u.AddUint64(u, d)
+					} else {
+						u.SubUint64(u, d)
+					}
+					b := make([]byte, tc.precBytes)
+					u.WriteToSlice(b)
+					inputs = append(inputs, b)
+				}
+			}
+		}
+		rng := fromSeedSHAKE(testSeed)
+		for i := 0; i < 20000; i++ {
+			b := make([]byte, tc.precBytes)
+			rng.Read(b)
+			inputs = append(inputs, b)
+		}
+		for _, u := range inputs {
+			sp.SetReader(bytes.NewReader(u))
+			want, err := sp.baseSampler()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sp.SetReader(bytes.NewReader(u))
+			if got, err := sp.baseSamplerCT(); err != nil || got != want {
+				t.Fatalf("%s: baseSamplerCT(%x) = %d, %v, want %d", tc.name, u, got, err, want)
+			}
+		}
+	}
+
+	for _, v := range samplerKATs() {
+		sp, err := NewSamplerWithOptions(bytesReader(decodeHexString(v.Octets)), WithConstantTimeBaseSampler())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z := sp.Samplerz(v.Mu, v.Sigma, v.Sigmin); z != v.Z {
+			t.Fatalf("KAT with the constant-time base sampler: got %d, want %d", z, v.Z)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package sampler
+
+import (
+	"io"
+	"sync"
+)
+
+// SamplerPool recycles samplers across goroutines. A Sampler is not safe for
+// concurrent use, so sampling concurrently takes one sampler per goroutine:
+// the pool is the supported way to do so without building a new sampler for
+// every request. A sampler returned by Get belongs to the caller until it
+// gives it back with Put.
+type SamplerPool struct {
+	pool sync.Pool
+}
+
+// NewSamplerPool returns a pool whose new samplers draw their randomness from
+// a reader returned by entropy, e.g. crypto/rand.Reader or a SHAKE256 stream
+// of a fresh seed. entropy may be called concurrently, and each of its
+// readers is used by a single sampler.
+func NewSamplerPool(entropy func() io.Reader) *SamplerPool {
+	p := new(SamplerPool)
+	p.pool.New = func() any {
+		return newsampler(entropy())
+	}
+	return p
+}
+
+// Get returns a sampler from the pool, building one if the pool is empty.
+func (p *SamplerPool) Get() *Sampler {
+	return p.pool.Get().(*Sampler)
+}
+
+// Put returns sp to the pool. sp must not be used after that.
+func (p *SamplerPool) Put(sp *Sampler) {
+	p.pool.Put(sp)
+}
@@ -0,0 +1,43 @@
+package sampler
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSamplerPool(t *testing.T) {
+	var seeds atomic.Uint64
+	pool := NewSamplerPool(func() io.Reader {
+		n := seeds.Add(1)
+		return fromSeedSHAKE([]byte{byte(n), byte(n >> 8)})
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sp := pool.Get()
+				for j := 0; j < 10; j++ {
+					if z := sp.Samplerz(5.5, 1.7, 1.28); z < -20 || z > 30 {
+						t.Errorf("sample %d far from the center", z)
+					}
+				}
+				pool.Put(sp)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := seeds.Load(); n == 0 || n > 8*200 {
+		t.Errorf("entropy called %d times", n)
+	}
+
+	// Samplers held at the same time are distinct.
+	a, b := pool.Get(), pool.Get()
+	if a == b {
+		t.Error("Get returned the same sampler twice")
+	}
+}
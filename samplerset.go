@@ -0,0 +1,34 @@
+package sampler
+
+// threadDomain separates the per-thread streams of a SamplerSet from any other
+// use of the seed.
+const threadDomain = "FalconSampler/SamplerSet/thread"
+
+// SamplerSet holds one sampler per thread of a pool, all derived from a
+// single seed. The sampler of a thread depends only on the seed and the
+// thread ID, so the output is reproducible regardless of scheduling, as long
+// as the work each thread does is deterministic.
+type SamplerSet struct {
+	samplers []*Sampler
+}
+
+// NewSamplerSet returns the samplers of nThreads threads. Thread i reads a
+// SHAKE256 stream seeded with threadDomain || uint64(i) || seed. It panics if
+// nThreads is not positive.
+func NewSamplerSet(seed []byte, nThreads int) *SamplerSet {
+	if nThreads <= 0 {
+		panic("sampler: NewSamplerSet with a non-positive number of threads")
+	}
+	set := &SamplerSet{samplers: make([]*Sampler, nThreads)}
+	for i := range set.samplers {
+		set.samplers[i] = newsampler(fromSeedSHAKE(domainSeed(threadDomain, uint64(i), seed)))
+	}
+	return set
+}
+
+// For returns the sampler of thread threadID, always the same one. Each
+// sampler must only be used by its own thread; For itself is safe for
+// concurrent use.
+func (set *SamplerSet) For(threadID int) *Sampler {
+	return set.samplers[threadID]
+}
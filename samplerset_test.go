@@ -0,0 +1,60 @@
+package sampler
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestSamplerSet(t *testing.T) {
+	const nThreads = 4
+	a := NewSamplerSet(testSeed, nThreads)
+	b := NewSamplerSet(testSeed, nThreads)
+
+	streams := make([][]int, nThreads)
+	for i := 0; i < nThreads; i++ {
+		if a.For(i) != a.For(i) {
+			t.Fatalf("For(%d) is not stable", i)
+		}
+		for j := 0; j < 64; j++ {
+			z := a.For(i).Samplerz(0, 1.7037990414754918, 1.2778336969128337)
+			if want := b.For(i).Samplerz(0, 1.7037990414754918, 1.2778336969128337); z != want {
+				t.Fatalf("thread %d, sample %d: got %d and %d from the same seed", i, j, z, want)
+			}
+			streams[i] = append(streams[i], z)
+		}
+	}
+	for i := range streams {
+		for j := i + 1; j < len(streams); j++ {
+			if slices.Equal(streams[i], streams[j]) {
+				t.Errorf("threads %d and %d draw the same samples", i, j)
+			}
+		}
+	}
+}
+
+func TestSamplerSetConcurrent(t *testing.T) {
+	const nThreads = 8
+	set := NewSamplerSet(testSeed, nThreads)
+	got := make([][]int, nThreads)
+	var wg sync.WaitGroup
+	for i := 0; i < nThreads; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				got[id] = append(got[id], set.For(id).Samplerz(float64(j), 1.5, 1.28))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ref := NewSamplerSet(testSeed, nThreads)
+	for i := 0; i < nThreads; i++ {
+		for j, z := range got[i] {
+			if want := ref.For(i).Samplerz(float64(j), 1.5, 1.28); z != want {
+				t.Fatalf("thread %d, sample %d: got %d concurrently, want %d", i, j, z, want)
+			}
+		}
+	}
+}
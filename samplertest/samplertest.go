@@ -0,0 +1,41 @@
+// Package samplertest provides a fake sampler for testing code that depends
+// on sampler.GaussianSampler without drawing real randomness.
+package samplertest
+
+import (
+	"fmt"
+
+	sampler "github.com/realForbis/FalconSampler"
+)
+
+// Call records the arguments of a call to FakeSampler.Samplerz.
+type Call struct {
+	Mu, Sigma, Sigmin float64
+}
+
+// FakeSampler is a sampler.GaussianSampler returning scripted values, in
+// order, and recording the arguments it was called with.
+type FakeSampler struct {
+	// Values are the samples returned, one per call. Samplerz panics once
+	// they are used up.
+	Values []int
+	// Calls are the arguments of the calls so far.
+	Calls []Call
+}
+
+var _ sampler.GaussianSampler = (*FakeSampler)(nil)
+
+// NewFakeSampler returns a FakeSampler returning values.
+func NewFakeSampler(values ...int) *FakeSampler {
+	return &FakeSampler{Values: values}
+}
+
+// Samplerz records its arguments and returns the next scripted value.
+func (f *FakeSampler) Samplerz(mu, sigma, sigmin float64) int {
+	i := len(f.Calls)
+	if i >= len(f.Values) {
+		panic(fmt.Sprintf("samplertest: Samplerz called %d times, only %d values scripted", i+1, len(f.Values)))
+	}
+	f.Calls = append(f.Calls, Call{mu, sigma, sigmin})
+	return f.Values[i]
+}
@@ -0,0 +1,46 @@
+package samplertest
+
+import (
+	"testing"
+
+	sampler "github.com/realForbis/FalconSampler"
+)
+
+// sumOfSamples stands for code that depends on a sampler.
+func sumOfSamples(s sampler.GaussianSampler, mus []float64) int {
+	var sum int
+	for _, mu := range mus {
+		sum += s.Samplerz(mu, 1.7, 1.28)
+	}
+	return sum
+}
+
+func TestFakeSampler(t *testing.T) {
+	f := NewFakeSampler(3, -1, 4)
+	if got := sumOfSamples(f, []float64{0.5, -2, 7.25}); got != 6 {
+		t.Errorf("sum of the scripted samples: got %d, want 6", got)
+	}
+	want := []Call{{0.5, 1.7, 1.28}, {-2, 1.7, 1.28}, {7.25, 1.7, 1.28}}
+	if len(f.Calls) != len(want) {
+		t.Fatalf("%d calls recorded, want %d", len(f.Calls), len(want))
+	}
+	for i := range want {
+		if f.Calls[i] != want[i] {
+			t.Errorf("call %d: got %+v, want %+v", i, f.Calls[i], want[i])
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic past the scripted values")
+		}
+	}()
+	f.Samplerz(0, 1.7, 1.28)
+}
+
+func TestSamplerIsGaussianSampler(t *testing.T) {
+	var s sampler.GaussianSampler = sampler.NewSamplerFromSeed([]byte("seed"))
+	if z := sumOfSamples(s, []float64{1e6}); z < 1e6-50 || z > 1e6+50 {
+		t.Errorf("sample %d far from its center", z)
+	}
+}
@@ -1,8 +1,18 @@
 package sampler
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
 	"math"
+	"math/big"
+	"math/bits"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	"github.com/holiman/uint256"
 )
@@ -12,13 +22,47 @@ const (
 	RCDTprec    uint8 = 72
 	RCDTprecLen uint8 = (RCDTprec >> 3)
 
-	inv2sigma2 float64 = 0.15086504887537272 // = 1 / (2 * (math.Pow(1.8205, 2)))
+	// Largest output of the base sampler with the default table, equal to
+	// len(RCDT). See Sampler.MaxBaseSample for custom tables.
+	BaseSamplerMax = 18
+
+	inv2sigma2 float64 = 0.15086504887537272 // = 1 / (2 * (math.Pow(MAX_SIGMA, 2)))
+
+	// Parameter of the half-Gaussian of RCDT, the upper bound on sigma.
+	MAX_SIGMA float64 = 1.8205
 
 	// ln(2) and 1 / ln(2), with ln the natural logarithm
 	LN2  float64 = 0.69314718056
 	ILN2 float64 = 1.44269504089
 )
 
+// ErrRNG is returned, wrapping the underlying cause, when the randomness
+// source fails to deliver the requested bytes.
+var ErrRNG = errors.New("sampler: randomness source failure")
+
+// ErrEntropyExhausted is returned, wrapping io.EOF or io.ErrUnexpectedEOF,
+// when the randomness source ends before delivering the requested bytes, as
+// a byte slice of test vectors that is too short. It wraps ErrRNG, so that
+// errors.Is(err, ErrRNG) holds for it as well.
+var ErrEntropyExhausted = fmt.Errorf("%w: source exhausted", ErrRNG)
+
+// ErrRejectionExhausted is returned when a sample is still rejected after the
+// number of iterations allowed by WithAdaptiveRejectionCap.
+var ErrRejectionExhausted = errors.New("sampler: rejection cap exhausted")
+
+// ErrInvalidSigma is returned, wrapped with a description, when sigma or
+// sigmin are out of the range supported by the sampler, or the center is not
+// within MaxCenter.
+var ErrInvalidSigma = errors.New("sampler: invalid sigma")
+
+// ErrOverflow is returned, wrapped with the offending sample, when a sample
+// does not fit in the integer type of the output, see SamplerzInto16.
+var ErrOverflow = errors.New("sampler: sample overflows the output type")
+
+// ErrSelfTest is returned, wrapped with the test statistic, when the output
+// of a sampler fails StatisticalSelfTest.
+var ErrSelfTest = errors.New("sampler: statistical self-test failed")
+
 // RCDT is the reverse cumulative distribution table of a distribution that
 // is very close to a half-Gaussian of parameter MAX_SIGMA.
 var RCDT = []*uint256.Int{
@@ -30,7 +74,7 @@ var RCDT = []*uint256.Int{
 	NewBigNumFromHex("0x774AC754ED74BD5F"),
 	NewBigNumFromHex("0x1024DD542B776AE4"),
 	NewBigNumFromHex("0x1A1FFDC65AD63DA"),
-	NewBigNumFromHex("0x1F80D88A7B64y28"),
+	NewBigNumFromHex("0x1F80D88A7B6428"),
 	NewBigNumFromHex("0x1C3FDB2040C69"),
 	NewBigNumFromHex("0x12CF24D031FB"),
 	NewBigNumFromHex("0x949F8B091F"),
@@ -45,7 +89,8 @@ var RCDT = []*uint256.Int{
 // C contains the coefficients of a polynomial that approximates exp(-x)
 // More precisely, the value:
 // (2 ** -63) * sum(C[12 - i] * (x ** i) for i in range(i))
-// Should be very close to exp(-x).
+// Should be very close to exp(-x): FACCT bounds its relative error over
+// [0, ln(2)] by 2^-47, which TestApproxExpErrorBound checks for approxexp.
 // This polynomial is lifted from FACCT: https://doi.org/10.1109/TC.2019.2940949
 var C = []*uint256.Int{
 	NewBigNumFromInt(0x00000004741183A3),
@@ -63,35 +108,296 @@ var C = []*uint256.Int{
 	NewBigNumFromInt(0x8000000000000000),
 }
 
-type sampler struct {
-	y   *uint256.Int
-	z   *uint256.Int
-	rng io.Reader
+// GaussianSampler is the Samplerz method of a Sampler, for code that takes
+// a sampler as a dependency and wants to substitute a fake in its tests, see
+// package samplertest.
+type GaussianSampler interface {
+	Samplerz(mu, sigma, sigmin float64) int
+}
+
+var _ GaussianSampler = (*Sampler)(nil)
 
-	baseSamplerRB []byte // lenght is not checked, but must be RCDTprecLen!
+// Sampler draws integers from a discrete Gaussian following the SamplerZ
+// algorithm of the Falcon specification.
+type Sampler struct {
+	y   *uint256.Int           // scratch value for the uniform u of baseSampler
+	rng atomic.Pointer[source] // swapped by Reseed, possibly mid-sample
+
+	baseSamplerRB []byte // as many bytes as the precision of rcdt
 	samplerzRB    []byte // lenght is not checked, but must be 1 byte!
 	berexpRB      []byte // lenght is not checked, but must be 1 byte!
+	berexpCTRB    []byte // lenght is not checked, but must be 8 bytes!
+
+	// Fixed-point configuration of approxexp, see WithApproxExpScale.
+	expShift uint     // approxexp works on multiples of 2^-expShift
+	expScale float64  // = 2^expShift
+	expC     []uint64 // C rescaled to 2^expShift
+
+	readTimeout time.Duration // 0 means reads may block forever
+	readBuffer  int           // size of the read-ahead buffer, 0 for none
+
+	// Base sampler table and the matching 1 / (2 * sigma^2), see WithTable.
+	rcdt       []*uint256.Int
+	inv2sigma2 float64
+	maxSigma   float64
+	halfNorm   float64 // normalization of the half-Gaussian of the table
+
+	sigmaGlobal float64 // signature sigma, see WithGlobalSigma
+
+	maxAbs *int // largest |z - round(mu)| seen, see WithMaxAbsTracker
+
+	onTrial func(z0, b int, z, x float64, accepted bool) // see WithTrialHook
+
+	rejectionMult float64 // see WithAdaptiveRejectionCap, 0 for no cap
+
+	constantTimeBerExp bool // use berexpCT, see WithConstantTimeBerExp
+
+	baseSamplerInclusive    bool // compare with <=, see WithBaseSamplerInclusive
+	constantTimeBaseSampler bool // use baseSamplerCT, see WithConstantTimeBaseSampler
+	littleEndianBase        bool // see WithLittleEndianBaseSampler
+	fixedPointExponent      bool // see WithFixedPointExponent
+
+	expCache []expCacheEntry // nil unless WithExpCache
+
+	witness *[]byte // records the bytes read, see SamplerzWithWitness
+
+	components *[2]int // z0 and b of the accepted trial, see SamplerzComponents
+}
+
+// source wraps the randomness source of a sampler so that it can be swapped
+// atomically.
+type source struct {
+	r  io.Reader
+	br io.ByteReader // r, if it implements io.ByteReader
+
+	// Read-ahead buffer, nil unless the sampler has a read buffer; it moves
+	// with the source so that Reseed also drops the buffered bytes.
+	buf      []byte
+	off, end int // unread part of buf
+}
+
+// newSource returns the source reading from r, buffered as configured by
+// WithReadBuffer.
+func (sp *Sampler) newSource(r io.Reader) *source {
+	src := newUnbufferedSource(r)
+	if sp.readBuffer > 0 {
+		src.buf = make([]byte, sp.readBuffer)
+	}
+	return src
 }
 
-func newsampler(reader io.Reader) *sampler {
-	sp := new(sampler)
+// newUnbufferedSource returns the source reading from r without a read-ahead
+// buffer.
+func newUnbufferedSource(r io.Reader) *source {
+	src := &source{r: r}
+	src.br, _ = r.(io.ByteReader)
+	return src
+}
+
+// read fills dst, serving it from the read-ahead buffer when there is one.
+// The buffer is refilled with a single read of at least the missing bytes, so
+// the stream is consumed in the same order as without buffering and a short
+// source fails only once it cannot provide the bytes actually needed.
+//
+// Single bytes, the sign bit and most of berexp, are read with ReadByte when
+// the source is an io.ByteReader, such as a bufio.Reader, and reads are not
+// bounded by a timeout.
+func (src *source) read(dst []byte, timeout time.Duration) error {
+	if len(dst) == 1 && src.br != nil && src.buf == nil && timeout <= 0 {
+		b, err := src.br.ReadByte()
+		if err != nil {
+			return err
+		}
+		dst[0] = b
+		return nil
+	}
+	if src.buf == nil {
+		_, err := readAtLeast(src.r, dst, len(dst), timeout)
+		return err
+	}
+	for len(dst) > 0 {
+		if src.off == src.end {
+			n, err := readAtLeast(src.r, src.buf, min(len(dst), len(src.buf)), timeout)
+			src.off, src.end = 0, n
+			if err != nil {
+				return err
+			}
+		}
+		n := copy(dst, src.buf[src.off:src.end])
+		src.off += n
+		dst = dst[n:]
+	}
+	return nil
+}
+
+func newsampler(reader io.Reader) *Sampler {
+	sp := new(Sampler)
 	sp.y = new(uint256.Int)
-	sp.z = new(uint256.Int)
 
-	sp.rng = reader
+	sp.rng.Store(sp.newSource(reader))
+	sp.setReadBuffers(int(RCDTprecLen))
+
+	sp.expShift = 63
+	sp.expScale = 1 << 63
+	sp.expC = scaledC(63)
 
-	sp.baseSamplerRB = make([]byte, RCDTprecLen)
-	sp.samplerzRB = make([]byte, 1)
-	sp.berexpRB = make([]byte, 1)
+	sp.rcdt = RCDT
+	sp.inv2sigma2 = inv2sigma2
+	sp.maxSigma = MAX_SIGMA
+	sp.halfNorm = halfGaussianNorm(inv2sigma2)
+
+	sp.sigmaGlobal = SigmaFalcon512
 
 	return sp
 }
 
-func (sp *sampler) read(dst []byte) {
-	_, err := io.ReadFull(sp.rng, dst)
-	if err != nil {
-		panic(err)
+// setReadBuffers allocates the read buffers of sp, with n bytes for the base
+// sampler. The buffers share one allocation, each capped to its own region.
+func (sp *Sampler) setReadBuffers(n int) {
+	rb := make([]byte, n+1+1+8)
+	sp.baseSamplerRB = rb[:n:n]
+	sp.samplerzRB = rb[n : n+1 : n+1]
+	sp.berexpRB = rb[n+1 : n+2 : n+2]
+	sp.berexpCTRB = rb[n+2:]
+}
+
+// NewSampler returns a sampler drawing its randomness from rng, with the
+// default configuration; see NewSamplerWithOptions for the others.
+func NewSampler(rng io.Reader) *Sampler {
+	return newsampler(rng)
+}
+
+// New is NewSampler.
+func New(rng io.Reader) *Sampler {
+	return NewSampler(rng)
+}
+
+// NewSamplerFromSeed returns a sampler drawing its randomness from a SHAKE256
+// stream seeded with seed, so that its samples are determined by the seed.
+//
+// The sequence of samples drawn from a given seed, with the same parameters,
+// is guaranteed to be the same across releases: it is locked in by the
+// golden file testdata/samplerz_seed.golden, and may only change to fix a
+// departure from the specification.
+//
+// The stream is read in blocks of seedReadBuffer bytes, as with
+// WithReadBuffer, which keeps the sequence since SHAKE256 output does not
+// depend on how it is split into reads.
+func NewSamplerFromSeed(seed []byte) *Sampler {
+	return newSeededSampler(seed)
+}
+
+// seedReadBuffer is the read-ahead buffer of the samplers drawing from a
+// SHAKE256 stream of their own, which saves most calls to the XOF.
+const seedReadBuffer = 512
+
+// newSeededSampler returns a buffered sampler drawing from the SHAKE256
+// stream of seed.
+func newSeededSampler(seed []byte) *Sampler {
+	sp := newsampler(nil)
+	sp.readBuffer = seedReadBuffer
+	sp.SetReader(fromSeedSHAKE(seed))
+	return sp
+}
+
+// NewSamplerFromBytes returns a sampler drawing its randomness from b, such as
+// the uniform bytes of a known answer test, in order. Once b is exhausted,
+// SamplerzErr returns an error wrapping ErrEntropyExhausted and io.EOF or
+// io.ErrUnexpectedEOF.
+func NewSamplerFromBytes(b []byte) *Sampler {
+	return newsampler(bytes.NewReader(b))
+}
+
+// NewSecureSampler returns a sampler drawing its randomness from
+// crypto/rand.Reader. Sample it with SamplerzErr or SamplerzChecked, so that
+// the rare failure of the system source is returned as an error wrapping
+// ErrRNG instead of crashing the process.
+func NewSecureSampler() *Sampler {
+	return newsampler(rand.Reader)
+}
+
+// Reseed replaces the randomness source with a SHAKE256 stream seeded with
+// seed, keeping the scratch values and read buffers of sp.
+//
+// Reseed may be called while another goroutine is sampling with sp: the new
+// source is used from the next read on, so a sample in progress may be drawn
+// from both the old and the new stream. The sampler itself is still not safe
+// for concurrent sampling.
+func (sp *Sampler) Reseed(seed []byte) {
+	sp.SetReader(fromSeedSHAKE(seed))
+}
+
+// SetReader replaces the randomness source with r, keeping the scratch values
+// and read buffers of sp. It may be called while sampling, as Reseed.
+func (sp *Sampler) SetReader(r io.Reader) {
+	sp.rng.Store(sp.newSource(r))
+}
+
+// Reader returns the randomness source of sp, as given to its constructor or
+// to SetReader, e.g. to inspect a CountingReader wrapping it. With a read
+// buffer (see WithReadBuffer), the source may be ahead of the bytes used so
+// far. Reading from it directly skips those bytes for sp.
+//
+// Reader and SetReader are atomic with respect to each other and to the reads
+// of sp. Even so, a caller who reads the source or swaps it while another
+// goroutine is sampling has no say in which sample the change lands in, so
+// inspecting and swapping are meant for the goroutine that samples.
+func (sp *Sampler) Reader() io.Reader {
+	if src := sp.rng.Load(); src != nil {
+		return src.r
+	}
+	return nil
+}
+
+// SamplerzFrom is Samplerz, but draws the randomness of this sample from r
+// instead of the source of sp, e.g. for a domain-separated stream. r is read
+// without the read buffer of sp, so exactly the bytes used are consumed from
+// it, and the source of sp is neither read nor advanced. It is restored when
+// SamplerzFrom returns, even when it panics, unless it was replaced meanwhile
+// by Reseed or SetReader.
+func (sp *Sampler) SamplerzFrom(r io.Reader, mu, sigma, sigmin float64) int {
+	tmp := newUnbufferedSource(r)
+	old := sp.rng.Swap(tmp)
+	defer sp.rng.CompareAndSwap(tmp, old)
+	return sp.Samplerz(mu, sigma, sigmin)
+}
+
+// Close wipes the secret-adjacent state of sp: its read buffers, the
+// read-ahead buffer of its source, the scratch value and the exp cache. The
+// seed given to NewSamplerFromSeed or Reseed is not stored, only the SHAKE256
+// state derived from it, which this package cannot wipe; it is dropped. Using
+// sp after Close is undefined, but currently fails with an error wrapping
+// ErrRNG.
+func (sp *Sampler) Close() {
+	if src := sp.rng.Swap(&source{r: closedReader{}}); src != nil {
+		clear(src.buf)
 	}
+	clear(sp.baseSamplerRB)
+	clear(sp.samplerzRB)
+	clear(sp.berexpRB)
+	clear(sp.berexpCTRB)
+	clear(sp.expCache)
+	sp.y.Clear()
+}
+
+// closedReader is the randomness source of a closed sampler.
+type closedReader struct{}
+
+func (closedReader) Read([]byte) (int, error) {
+	return 0, errors.New("sampler: closed")
+}
+
+func (sp *Sampler) read(dst []byte) error {
+	if err := sp.rng.Load().read(dst, sp.readTimeout); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: reading %d bytes: %w", ErrEntropyExhausted, len(dst), err)
+		}
+		return fmt.Errorf("%w: reading %d bytes: %w", ErrRNG, len(dst), err)
+	}
+	if sp.witness != nil {
+		*sp.witness = append(*sp.witness, dst...)
+	}
+	return nil
 }
 
 // Require: -
@@ -102,18 +408,104 @@ func (sp *sampler) read(dst []byte) {
 // 4: 	z0 ← z0 + Ju < RCDT[i]K
 // 5: return z0
 // https://falcon-sign.info/falcon.pdf#57
-func (sp *sampler) baseSampler() int {
+func (sp *Sampler) baseSampler() (int, error) {
 	var z0 int
 	u := sp.y
-	sp.read(sp.baseSamplerRB)
-	u.SetBytes(sp.baseSamplerRB)
-	for _, elt := range RCDT {
-		// z0 += 1 if (u < elt)
-		if u.Cmp(elt) == -1 {
+	if err := sp.readUniform(u); err != nil {
+		return 0, err
+	}
+	for _, elt := range sp.rcdt {
+		// z0 += 1 if (u < elt), or (u <= elt) if inclusive
+		if c := u.Cmp(elt); c == -1 || (c == 0 && sp.baseSamplerInclusive) {
 			z0 += 1
 		}
 	}
-	return z0
+	return z0, nil
+}
+
+// baseSamplerCT is baseSampler without data-dependent branches: each entry is
+// compared with the uniform u by the borrow of the full-width subtraction
+// u - elt, which is 1 exactly when u < elt, and the borrows are summed. The
+// work is the same whatever u, which closes the timing channel of the
+// comparisons and of the conditional increment of baseSampler.
+func (sp *Sampler) baseSamplerCT() (int, error) {
+	u := sp.y
+	if err := sp.readUniform(u); err != nil {
+		return 0, err
+	}
+	var z0 uint64
+	if sp.baseSamplerInclusive {
+		// u <= elt is the complement of elt < u.
+		for _, elt := range sp.rcdt {
+			z0 += 1 - lessCT(elt, u)
+		}
+	} else {
+		for _, elt := range sp.rcdt {
+			z0 += lessCT(u, elt)
+		}
+	}
+	return int(z0), nil
+}
+
+// readUniform sets u to the uniform value of the base sampler, read from
+// as many bytes as the precision of its table, big-endian unless
+// WithLittleEndianBaseSampler.
+func (sp *Sampler) readUniform(u *uint256.Int) error {
+	if err := sp.read(sp.baseSamplerRB); err != nil {
+		return err
+	}
+	if sp.littleEndianBase {
+		slices.Reverse(sp.baseSamplerRB)
+	}
+	u.SetBytes(sp.baseSamplerRB)
+	return nil
+}
+
+// lessCT returns 1 if a < b and 0 otherwise, in constant time.
+func lessCT(a, b *uint256.Int) uint64 {
+	var borrow uint64
+	for i := range a {
+		_, borrow = bits.Sub64(a[i], b[i], borrow)
+	}
+	return borrow
+}
+
+// BaseSamplerErr returns a sample of the base sampler of sp, the half
+// Gaussian of sigma MAX_SIGMA over the non-negative integers, drawn as in
+// the rejection loop of Samplerz, with WithConstantTimeBaseSampler if set.
+// It returns an error wrapping ErrRNG if the randomness source fails.
+//
+// Together with SamplerzErr and BerExpErr it makes an API that never panics
+// on a failing source, e.g. for a WebAssembly host that cannot recover from a
+// panic.
+func (sp *Sampler) BaseSamplerErr() (int, error) {
+	if sp.constantTimeBaseSampler {
+		return sp.baseSamplerCT()
+	}
+	return sp.baseSampler()
+}
+
+// MaxBaseSample returns the largest value the base sampler of sp can return,
+// which is the length of its table: BaseSamplerMax unless it was built with
+// WithTable.
+func (sp *Sampler) MaxBaseSample() int {
+	return len(sp.rcdt)
+}
+
+// scaledC returns the coefficients of C rescaled from 2^63 to 2^shift.
+func scaledC(shift uint) []uint64 {
+	c := make([]uint64, len(C))
+	for i, elt := range C {
+		c[i] = elt.Uint64() >> (63 - shift)
+	}
+	return c
+}
+
+// mulShift returns (a * b) >> shift, for shift in [1, 63], computed on the
+// 128-bit product.
+func mulShift(a, b uint64, shift uint) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi<<(64-shift) | lo>>shift
 }
 
 // Require: Floating-point values x ∈ [0, ln(2)] and ccs ∈ [0, 1]
@@ -127,19 +519,61 @@ func (sp *sampler) baseSampler() int {
 // 7: y ← (z · y) >> 63
 // 8: return y
 // https://falcon-sign.info/falcon.pdf#d0
-func (sp *sampler) approxexp(x, ccs float64) uint64 {
-	sp.y.Set(C[0])
+//
+// The computation is carried out on multiples of 2^-expShift (63 unless
+// configured with WithApproxExpScale) and the result is scaled back to
+// 2^63 precision, so callers never see the internal scale. Every value is at
+// most 2^expShift, so a product fits in 128 bits and, shifted back, in 64.
+func (sp *Sampler) approxexp(x, ccs float64) uint64 {
 	// Since z is positive, int is equivalent to floor
-	sp.z.SetUint64(uint64(x * (1 << 63)))
-	for _, elt := range C[1:] {
-		sp.y.Mul(sp.y, sp.z) // y = z * y
-		sp.y.Rsh(sp.y, 63)   // y = y >> 63
-		sp.y.Sub(elt, sp.y)  // y = elt - y
+	return sp.approxexpFixed(uint64(x*sp.expScale), sp.fixedCCS(ccs))
+}
+
+// fixedCCS returns ccs as a multiple of 2^-expShift, clamped into [0, 1]: the
+// conversion of a float64 of 2^64 or more to uint64 is undefined, and a ccs
+// above 1, or NaN, can only come from parameters out of range.
+func (sp *Sampler) fixedCCS(ccs float64) uint64 {
+	if !(ccs > 0) {
+		return 0
+	}
+	return uint64(min(ccs, 1) * sp.expScale)
+}
+
+// approxexpFixed is approxexp given x and ccs in fixed point, as multiples
+// of 2^-expShift.
+func (sp *Sampler) approxexpFixed(zx, zccs uint64) uint64 {
+	y := sp.expC[0]
+	for _, elt := range sp.expC[1:] {
+		y = elt - mulShift(zx, y, sp.expShift) // y = elt - (z * y) >> expShift
 	}
-	sp.z.SetUint64(uint64(ccs * float64((1<<63)<<1)))
-	sp.y.Mul(sp.z, sp.y) // y = z * y
-	sp.y.Rsh(sp.y, 63)   // y = y >> 63
-	return sp.y.Uint64()
+	y = mulShift(zccs, y, sp.expShift) // y = (z * y) >> expShift
+	return y << (63 - sp.expShift)
+}
+
+// ApproxExp returns 2^63 · ccs · exp(−x), as computed by the ApproxExp
+// algorithm of the specification for x ∈ [0, ln(2)] and ccs ∈ [0, 1], at the
+// scale configured for sp. It is exported for cross-checking the
+// intermediate values of reference implementations.
+func (sp *Sampler) ApproxExp(x, ccs float64) uint64 {
+	return sp.approxexp(x, ccs)
+}
+
+// BerExp returns a bit equal to 1 with probability ≈ ccs · exp(−x), drawing
+// from the randomness source of sp as the BerExp algorithm of the
+// specification, whatever WithConstantTimeBerExp. It panics if the
+// randomness source fails.
+func (sp *Sampler) BerExp(x, ccs float64) bool {
+	accept, err := sp.BerExpErr(x, ccs)
+	if err != nil {
+		panic(err)
+	}
+	return accept
+}
+
+// BerExpErr is BerExp, but returns an error wrapping ErrRNG instead of
+// panicking when the randomness source fails.
+func (sp *Sampler) BerExpErr(x, ccs float64) (bool, error) {
+	return sp.berexp(x, ccs)
 }
 
 // Require: Floating point values x, ccs ≥ 0
@@ -155,21 +589,84 @@ func (sp *sampler) approxexp(x, ccs float64) uint64 {
 // 9: while ((w = 0) and (i > 0))
 // 10: return Jw < 0K ▷ Return 1 with probability 2−64 · z ≈ ccs · exp(−x)
 // https://falcon-sign.info/falcon.pdf#cf
-func (sp sampler) berexp(x, ccs float64) bool {
+func (sp *Sampler) berexp(x, ccs float64) (bool, error) {
+	return sp.bernoulli(sp.berexpThreshold(x, ccs))
+}
+
+// bernoulli is berexp, steps 5 to 10, given the threshold z: it returns
+// whether a uniform 64-bit integer, drawn byte by byte, is below z.
+func (sp *Sampler) bernoulli(z uint64) (bool, error) {
 	var w int
-	s := math.Floor(x * ILN2)
-	r := x - s*LN2
-	s = Min(s, 63)
-	z := (sp.approxexp(r, ccs) - 1) >> int(s)
-	for i := 56; i >= -8; i -= 8 {
-		sp.read(sp.berexpRB)
-		p := int(sp.berexpRB[0])
-		w = p - int((z>>uint64(i)))&0xFF
+	// The do-while of the specification: i runs from 56 down to 0, the
+	// last byte is compared at i = 0 and w = 0 there means rejection.
+	for i := 56; i >= 0; i -= 8 {
+		if err := sp.read(sp.berexpRB); err != nil {
+			return false, err
+		}
+		// & binds tighter than - in Go, the parentheses only spell it out.
+		w = int(sp.berexpRB[0]) - int((z>>uint64(i))&0xFF)
 		if w != 0 {
 			break
 		}
 	}
-	return w < 0
+	return w < 0, nil
+}
+
+// berexpThreshold returns the value z of berexp, steps 1 to 4: a uniform
+// 64-bit integer is below z with probability ≈ ccs · exp(−x).
+//
+// 2 · ApproxExp(r, ccs) − 1 is computed modulo 2^64: for ccs = 1 and r = 0,
+// ApproxExp is 2^63 and the result is 2^64 − 1 as expected, but for an
+// ApproxExp of 0 it would wrap to 2^64 − 1 instead of −1, so z is then 0.
+func (sp *Sampler) berexpThreshold(x, ccs float64) uint64 {
+	return sp.berexpThresholdZ(x, ccs, sp.fixedCCS(ccs))
+}
+
+// berexpThresholdZ is berexpThreshold given also zccs = fixedCCS(ccs), which
+// the rejection loop computes once per sample instead of once per trial.
+func (sp *Sampler) berexpThresholdZ(x, ccs float64, zccs uint64) uint64 {
+	s := math.Floor(x * ILN2)
+	// As LN2 * ILN2 is slightly above 1, r is a few ulps below 0 for x just
+	// below a multiple of LN2, and would wrap around in its conversion to
+	// fixed point in approxexp.
+	r := Clamp(x-s*LN2, 0, LN2)
+	s = Clamp(s, 0, 63)
+	return threshold(sp.cachedApproxexp(r, ccs, zccs), uint64(s))
+}
+
+// threshold returns (2y - 1) >> s, or 0 for y = 0, see berexpThreshold,
+// without branching on y.
+func threshold(y, s uint64) uint64 {
+	nonZero := -((y | -y) >> 63) // all ones unless y = 0
+	return (2*y - 1) >> s & nonZero
+}
+
+// berexpCT is berexp without the early exit: it always draws 8 bytes and
+// compares all of them with z, keeping the first non-zero difference with a
+// mask instead of a branch.
+//
+// The early exit of berexp leaks, through the number of bytes drawn and the
+// time spent, how many leading bytes of the uniform value match z, and so
+// some information on z, which depends on the secret center and sigma. With
+// berexpCT the work done no longer depends on either. The decision is the
+// same as that of berexp for the same 8 bytes.
+func (sp *Sampler) berexpCT(x, ccs float64) (bool, error) {
+	return sp.bernoulliCT(sp.berexpThreshold(x, ccs))
+}
+
+// bernoulliCT is bernoulli without the early exit, see berexpCT.
+func (sp *Sampler) bernoulliCT(z uint64) (bool, error) {
+	if err := sp.read(sp.berexpCTRB); err != nil {
+		return false, err
+	}
+	var w int64
+	for j, i := 0, 56; i >= 0; j, i = j+1, i-8 {
+		d := int64(sp.berexpCTRB[j]) - int64((z>>uint64(i))&0xFF)
+		// decided is -1 once a difference has been found, 0 before.
+		decided := (w | -w) >> 63
+		w |= d &^ decided
+	}
+	return w < 0, nil
 }
 
 // Given floating-point values mu, sigma (and sigmin),
@@ -186,21 +683,351 @@ func (sp sampler) berexp(x, ccs float64) bool {
 // Output:
 // - a sample z from the distribution D_{Z, mu, sigma}.
 // https://falcon-sign.info/falcon.pdf#58
-func (sp *sampler) Samplerz(mu float64, sigma float64, sigmin float64) int {
-	s := int(math.Floor(mu))
-	r := mu - float64(s)
-	dss := 1 / (2 * sigma * sigma)
-	ccs := sigmin / sigma
-	for {
-		z0 := sp.baseSampler()
-		sp.read(sp.samplerzRB)
+//
+// Samplerz panics if the randomness source fails, see SamplerzErr.
+func (sp *Sampler) Samplerz(mu float64, sigma float64, sigmin float64) int {
+	z, err := sp.SamplerzErr(mu, sigma, sigmin)
+	if err != nil {
+		panic(err)
+	}
+	return z
+}
+
+// SampleZ is Samplerz: it returns a sample of the discrete Gaussian of
+// center mu and standard deviation sigma over the integers, for 1 < sigmin <
+// sigma < MAX_SIGMA. It panics if the randomness source fails, see
+// SamplerzErr.
+func (sp *Sampler) SampleZ(mu, sigma, sigmin float64) int {
+	return sp.Samplerz(mu, sigma, sigmin)
+}
+
+// SampleZErr is SamplerzErr, the form of SampleZ returning the errors of the
+// randomness source instead of panicking.
+func (sp *Sampler) SampleZErr(mu, sigma, sigmin float64) (int, error) {
+	return sp.SamplerzErr(mu, sigma, sigmin)
+}
+
+// SamplerzErr is Samplerz, but returns an error wrapping ErrRNG instead of
+// panicking when the randomness source fails, and ErrRejectionExhausted when
+// the rejection cap of WithAdaptiveRejectionCap is reached. A center beyond
+// MaxCenter, a NaN center, a NaN or infinite sigma or sigmin, and parameters
+// for which the exponent of the rejection step is NaN or infinite, give an
+// error wrapping ErrInvalidSigma.
+func (sp *Sampler) SamplerzErr(mu float64, sigma float64, sigmin float64) (int, error) {
+	z, _, err := sp.samplerz(mu, sigma, sigmin)
+	return z, err
+}
+
+// SamplerzContext is SamplerzErr, but checks ctx before each iteration of the
+// rejection loop and returns ctx.Err() once ctx is done, which bounds the time
+// spent on a sample in a request-scoped caller. Until then, it draws the same
+// randomness and returns the same samples as Samplerz.
+func (sp *Sampler) SamplerzContext(ctx context.Context, mu, sigma, sigmin float64) (int, error) {
+	z, _, err := sp.samplerzWith(ctx, mu, sp.newSigmaParams(sigma, sigmin))
+	return z, err
+}
+
+// samplerz implements Samplerz, and also returns the number of iterations of
+// the rejection loop.
+func (sp *Sampler) samplerz(mu float64, sigma float64, sigmin float64) (int, int, error) {
+	return sp.samplerzWith(context.Background(), mu, sp.newSigmaParams(sigma, sigmin))
+}
+
+// sigmaParams are the values of the rejection loop that only depend on sigma
+// and sigmin, computed once for a batch sharing them.
+type sigmaParams struct {
+	sigma  float64
+	sigmin float64
+	dss    float64 // 1 / (2 * sigma^2)
+	ccs    float64 // sigmin / sigma
+	zccs   uint64  // ccs in fixed point, see fixedCCS
+	limit  int     // iteration cap, see WithAdaptiveRejectionCap
+}
+
+func (sp *Sampler) newSigmaParams(sigma, sigmin float64) sigmaParams {
+	return sp.sigmaParamsOf(&SigmaContext{sigma: sigma, sigmin: sigmin, dss: 1 / (2 * sigma * sigma), ccs: sigmin / sigma})
+}
+
+// sigmaParamsOf completes the values of sc with those that also depend on
+// the configuration of sp.
+func (sp *Sampler) sigmaParamsOf(sc *SigmaContext) sigmaParams {
+	p := sigmaParams{
+		sigma:  sc.sigma,
+		sigmin: sc.sigmin,
+		dss:    sc.dss,
+		ccs:    sc.ccs,
+		zccs:   sp.fixedCCS(sc.ccs),
+		limit:  math.MaxInt,
+	}
+	if sp.rejectionMult > 0 {
+		p.limit = int(math.Ceil(sp.rejectionMult * expectedIterations(sc.sigma, sc.sigmin, sp.halfNorm)))
+	}
+	return p
+}
+
+// SigmaContext holds the values of the rejection loop of Samplerz that only
+// depend on sigma and sigmin, for callers that sample many centers with the
+// same pair, see SamplerzCtx. It does not depend on the sampler, and is
+// safe for concurrent use.
+type SigmaContext struct {
+	sigma, sigmin float64
+	dss           float64 // 1 / (2 * sigma^2)
+	ccs           float64 // sigmin / sigma
+}
+
+// NewSigmaContext returns the SigmaContext of sigma and sigmin, or an error
+// wrapping ErrInvalidSigma unless 1 < sigmin < sigma and sigma is finite. The
+// upper bound of sigma depends on the table of the sampler, and is checked by
+// SamplerzCtx.
+func NewSigmaContext(sigma, sigmin float64) (*SigmaContext, error) {
+	if err := checkSigmaRange(sigma, sigmin, math.Inf(1)); err != nil {
+		return nil, err
+	}
+	return &SigmaContext{sigma: sigma, sigmin: sigmin, dss: 1 / (2 * sigma * sigma), ccs: sigmin / sigma}, nil
+}
+
+// Sigma returns the sigma of sc.
+func (sc *SigmaContext) Sigma() float64 { return sc.sigma }
+
+// Sigmin returns the sigmin of sc.
+func (sc *SigmaContext) Sigmin() float64 { return sc.sigmin }
+
+// SamplerzCtx is Samplerz(mu, sc.Sigma(), sc.Sigmin()), with the values of
+// sc computed once instead of on every call. The samples are the same. It
+// panics as Samplerz, and with an error wrapping ErrInvalidSigma unless
+// sc.Sigma() is below the sigma of the base sampler table of sp.
+func (sp *Sampler) SamplerzCtx(sc *SigmaContext, mu float64) int {
+	if err := sp.checkSigma(sc.sigma, sc.sigmin); err != nil {
+		panic(err)
+	}
+	z, _, err := sp.samplerzWith(context.Background(), mu, sp.sigmaParamsOf(sc))
+	if err != nil {
+		panic(err)
+	}
+	return z
+}
+
+// MaxCenter is the largest magnitude of the centers of Samplerz: up to 2^53,
+// every integer center is exact as a float64, and the floor of the center,
+// plus the offset of a sample, fits in an int. On 32-bit platforms, where
+// int is narrower, it is 2^30.
+const MaxCenter = min(1<<53, math.MaxInt>>1)
+
+// samplerzWith is samplerz with its sigma-dependent values precomputed, and
+// stops with the error of ctx before any iteration once ctx is done.
+func (sp *Sampler) samplerzWith(ctx context.Context, mu float64, p sigmaParams) (int, int, error) {
+	s, r, err := splitCenter(mu)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := p.checkFinite(); err != nil {
+		return 0, 0, err
+	}
+	return sp.samplerzAt(ctx, mu, s, r, p)
+}
+
+// checkFinite returns an error wrapping ErrInvalidSigma if sigma is not
+// positive and finite, see validateSigma, or ccs is NaN or infinite, which is
+// then the case if sigmin is. The rejection loop would then never accept, or
+// accept with a ccs meaningless for the distribution.
+func (p sigmaParams) checkFinite() error {
+	if err := validateSigma(p.sigma); err != nil {
+		return err
+	}
+	if math.IsNaN(p.ccs) || math.IsInf(p.ccs, 0) {
+		return fmt.Errorf("%w: sigma = %v and sigmin = %v give ccs = %v", ErrInvalidSigma, p.sigma, p.sigmin, p.ccs)
+	}
+	return nil
+}
+
+// splitCenter returns the integer part s = floor(mu) of a center and its
+// fractional part r = mu - s.
+func splitCenter(mu float64) (s int, r float64, err error) {
+	if !(math.Abs(mu) <= MaxCenter) {
+		// Beyond, the conversion to int overflows, and r would be far out
+		// of [0, 1), so that no trial is ever accepted.
+		return 0, 0, fmt.Errorf("%w: center mu = %v beyond %v", ErrInvalidSigma, mu, float64(MaxCenter))
+	}
+	s = int(math.Floor(mu))
+	return s, mu - float64(s), nil
+}
+
+// samplerzAt is samplerzWith given the split s, r of mu from splitCenter.
+func (sp *Sampler) samplerzAt(ctx context.Context, mu float64, s int, r float64, p sigmaParams) (int, int, error) {
+	dss, ccs := p.dss, p.ccs
+	for iter := 1; ; iter++ {
+		if err := ctx.Err(); err != nil {
+			return 0, iter - 1, err
+		}
+		if iter > p.limit {
+			return 0, p.limit, ErrRejectionExhausted
+		}
+		z0, err := sp.BaseSamplerErr()
+		if err != nil {
+			return 0, iter, err
+		}
+		if err := sp.read(sp.samplerzRB); err != nil {
+			return 0, iter, err
+		}
 		b := int(sp.samplerzRB[0])
 		b &= 1
 		z := float64(b + (2*b-1)*z0)
-		x := math.Pow((z-r), 2) * dss
-		x -= math.Pow(float64(z0), 2) * inv2sigma2
-		if sp.berexp(x, ccs) {
-			return s + int(z)
+		var threshold uint64
+		var x float64
+		if sp.fixedPointExponent {
+			threshold, err = sp.berexpThresholdFixed(b+(2*b-1)*z0, z0, r, p)
+			if err != nil {
+				return 0, iter, err
+			}
+			if sp.onTrial != nil {
+				x = math.Pow((z-r), 2)*dss - math.Pow(float64(z0), 2)*sp.inv2sigma2
+			}
+		} else {
+			x = math.Pow((z-r), 2) * dss
+			x -= math.Pow(float64(z0), 2) * sp.inv2sigma2
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				// berexp cannot split a NaN or infinite x, so this is
+				// reported as bad parameters, e.g. a mu that is not finite.
+				return 0, iter, fmt.Errorf("%w: x = %v for mu = %v and sigma = %v", ErrInvalidSigma, x, mu, p.sigma)
+			}
+			threshold = sp.berexpThresholdZ(x, ccs, p.zccs)
+		}
+		var accept bool
+		if sp.constantTimeBerExp {
+			accept, err = sp.bernoulliCT(threshold)
+		} else {
+			accept, err = sp.bernoulli(threshold)
+		}
+		if err != nil {
+			return 0, iter, err
+		}
+		if sp.onTrial != nil {
+			sp.onTrial(z0, b, z, x, accept)
 		}
+		if accept {
+			if sp.maxAbs != nil {
+				*sp.maxAbs = max(*sp.maxAbs, abs(s+int(z)-roundCenter(mu)))
+			}
+			if sp.components != nil {
+				*sp.components = [2]int{z0, b}
+			}
+			return s + int(z), iter, nil
+		}
+	}
+}
+
+// SamplerzChecked is SamplerzErr, but first checks that the parameters are in
+// the range supported by the sampler, and returns an error wrapping
+// ErrInvalidSigma if they are not.
+//
+// Subnormal values, which may come from an upstream underflow, are handled
+// explicitly: a subnormal sigma or sigmin is rejected, and a subnormal mu is
+// flushed to 0. Otherwise a tiny negative mu would be split into the center
+// -1 and a fractional part rounding to 1, outside of the range expected by
+// the rejection loop.
+func (sp *Sampler) SamplerzChecked(mu, sigma, sigmin float64) (int, error) {
+	if isSubnormal(sigma) || isSubnormal(sigmin) {
+		return 0, fmt.Errorf("%w: subnormal sigmin = %v or sigma = %v", ErrInvalidSigma, sigmin, sigma)
+	}
+	if err := sp.checkSigma(sigma, sigmin); err != nil {
+		return 0, err
+	}
+	if isSubnormal(mu) {
+		mu = 0
+	}
+	return sp.SamplerzErr(mu, sigma, sigmin)
+}
+
+// checkSigma reports whether 1 < sigmin < sigma < the sigma of the base
+// sampler table, as required by Samplerz.
+func (sp *Sampler) checkSigma(sigma, sigmin float64) error {
+	return checkSigmaRange(sigma, sigmin, sp.maxSigma)
+}
+
+// checkSigmaRange returns an error wrapping ErrInvalidSigma unless
+// 1 < sigmin < sigma < maxSigma.
+func checkSigmaRange(sigma, sigmin, maxSigma float64) error {
+	if !(1 < sigmin && sigmin < sigma && sigma < maxSigma) {
+		return fmt.Errorf("%w: need 1 < sigmin < sigma < %v, got sigmin = %v and sigma = %v",
+			ErrInvalidSigma, maxSigma, sigmin, sigma)
+	}
+	return nil
+}
+
+// roundCenter rounds mu to the nearest integer, halves away from zero, which
+// is the convention of every API working relative to the center.
+func roundCenter(mu float64) int {
+	return int(math.Round(mu))
+}
+
+// SamplerzOffset returns the offset Samplerz(mu, sigma, sigmin) - round(mu)
+// of a sample from its center, with round(mu) rounding halves away from zero
+// (so 2.5 rounds to 3 and -2.5 to -3). For an integer mu this is the
+// centered sample.
+func (sp *Sampler) SamplerzOffset(mu, sigma, sigmin float64) int {
+	return sp.Samplerz(mu, sigma, sigmin) - roundCenter(mu)
+}
+
+// SamplerzComponents returns the sample of Samplerz(mu, sigma, sigmin)
+// decomposed as in the accepting trial of the rejection loop: the center
+// floor(mu), the magnitude z0 drawn by the base sampler and the sign bit b,
+// so that the sample is center + b + (2b - 1) * magnitude. It panics as
+// Samplerz.
+func (sp *Sampler) SamplerzComponents(mu, sigma, sigmin float64) (center, magnitude, sign int) {
+	var c [2]int
+	sp.components = &c
+	defer func() { sp.components = nil }()
+	sp.Samplerz(mu, sigma, sigmin)
+	return int(math.Floor(mu)), c[0], c[1]
+}
+
+// MaxCenter64 is the largest magnitude of the centers of SamplerzInt64,
+// 2^53 on every platform: up to there every integer is exact as a float64,
+// so that the center floor(mu) and the fractional part mu - floor(mu) are
+// computed without rounding. Beyond, consecutive float64 values are 2 or more
+// apart and mu no longer has a fractional part to sample around.
+const MaxCenter64 = 1 << 53
+
+// SamplerzInt64 is Samplerz, but returns an int64 and accepts centers up to
+// MaxCenter64 also on platforms where int is 32 bits wide: the center
+// floor(mu) is kept in an int64, and only the offset of the sample from it,
+// a few sigma at most, goes through Samplerz. It returns the same samples as
+// Samplerz where both apply. It panics as Samplerz, and for a center beyond
+// MaxCenter64 with an error wrapping ErrInvalidSigma.
+func (sp *Sampler) SamplerzInt64(mu, sigma, sigmin float64) int64 {
+	if !(math.Abs(mu) <= MaxCenter64) {
+		panic(fmt.Errorf("%w: center mu = %v beyond %v", ErrInvalidSigma, mu, float64(MaxCenter64)))
+	}
+	s := math.Floor(mu)
+	return int64(s) + int64(sp.Samplerz(mu-s, sigma, sigmin))
+}
+
+// SamplerzBig is Samplerz for a center given to more than float64 precision.
+// The center s = floor(mu) and the fractional part r = mu - s are computed
+// exactly from mu, and only r is rounded to a float64 for the rejection loop,
+// which works in float64 (or fixed point) whatever its inputs: the exponent
+// then sees r to a relative 2^-53, rather than to the ulp of mu, which is
+// coarser than that as soon as |mu| > 1. For instance at mu = 2^40 + r, a
+// float64 mu has r to 2^-12 only. A mu that is exact as a float64 gives the
+// sample of Samplerz(mu, sigma, sigmin) for the same randomness. r is below
+// 1 but may round to 1, which is then the center s + 1 with r = 0.
+//
+// It panics as Samplerz, and with an error wrapping ErrInvalidSigma for an
+// infinite mu or a center beyond MaxCenter.
+func (sp *Sampler) SamplerzBig(mu *big.Float, sigma, sigmin float64) int {
+	if mu.IsInf() {
+		panic(fmt.Errorf("%w: infinite center mu", ErrInvalidSigma))
+	}
+	// Int truncates towards zero, so s is one above the floor for a
+	// negative non-integer mu.
+	s, acc := mu.Int(nil)
+	if acc == big.Above {
+		s.Sub(s, big.NewInt(1))
+	}
+	if !s.IsInt64() || s.Int64() < -MaxCenter || s.Int64() > MaxCenter {
+		panic(fmt.Errorf("%w: center mu = %v beyond %v", ErrInvalidSigma, mu, float64(MaxCenter)))
 	}
+	prec := max(mu.MinPrec(), 64) + uint(s.BitLen())
+	r, _ := new(big.Float).SetPrec(prec).Sub(mu, new(big.Float).SetInt(s)).Float64()
+	return int(s.Int64()) + sp.Samplerz(r, sigma, sigmin)
 }
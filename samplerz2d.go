@@ -0,0 +1,43 @@
+package sampler
+
+import (
+	"fmt"
+	"math"
+)
+
+// Samplerz2D returns a sample of the discrete Gaussian over Z^2 of center mu
+// and covariance matrix cov, whose entries are variances: cov = sigma^2 * I
+// gives two independent Samplerz(mu[i], sigma, sigmin).
+//
+// The matrix is decomposed as in a 2x2 Cholesky or LDL factorization: the
+// second coordinate is sampled with sigma = sqrt(cov[1][1]), then the first
+// one conditioned on it, with the center shifted by cov[0][1] / cov[1][1]
+// times the offset of the second one and the variance reduced to the Schur
+// complement cov[0][0] - cov[0][1]^2 / cov[1][1]. As for the ffSampling tree,
+// both conditional sigmas must be in (sigmin, MAX_SIGMA).
+//
+// It returns an error wrapping ErrInvalidSigma if cov is not symmetric
+// positive-definite or the sigmas are out of range, and the errors of
+// SamplerzErr.
+func (sp *Sampler) Samplerz2D(mu [2]float64, cov [2][2]float64, sigmin float64) ([2]int, error) {
+	if cov[0][1] != cov[1][0] {
+		return [2]int{}, fmt.Errorf("%w: covariance %v is not symmetric", ErrInvalidSigma, cov)
+	}
+	det := cov[0][0]*cov[1][1] - cov[0][1]*cov[1][0]
+	if !(cov[1][1] > 0 && det > 0) || math.IsInf(cov[0][0], 0) || math.IsInf(cov[1][1], 0) {
+		return [2]int{}, fmt.Errorf("%w: covariance %v is not positive-definite", ErrInvalidSigma, cov)
+	}
+	sigma1 := math.Sqrt(cov[1][1])
+	sigma0 := math.Sqrt(det / cov[1][1])
+
+	z1, err := sp.SamplerzChecked(mu[1], sigma1, sigmin)
+	if err != nil {
+		return [2]int{}, err
+	}
+	c0 := mu[0] + cov[0][1]/cov[1][1]*(float64(z1)-mu[1])
+	z0, err := sp.SamplerzChecked(c0, sigma0, sigmin)
+	if err != nil {
+		return [2]int{}, err
+	}
+	return [2]int{z0, z1}, nil
+}
@@ -0,0 +1,57 @@
+package sampler
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestSamplerz2D(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	mu := [2]float64{2.3, -7.6}
+	cov := [2][2]float64{{3, 0.8}, {0.8, 2.5}}
+	const n = 200000
+	var sum [2]float64
+	var prod [2][2]float64
+	for i := 0; i < n; i++ {
+		z, err := sp.Samplerz2D(mu, cov, 1.28)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for a := 0; a < 2; a++ {
+			sum[a] += float64(z[a])
+			for b := 0; b < 2; b++ {
+				prod[a][b] += float64(z[a]) * float64(z[b])
+			}
+		}
+	}
+	for a := 0; a < 2; a++ {
+		if mean := sum[a] / n; math.Abs(mean-mu[a]) > 0.02 {
+			t.Errorf("mean %d: got %f, want %f", a, mean, mu[a])
+		}
+		for b := 0; b < 2; b++ {
+			c := prod[a][b]/n - sum[a]/n*sum[b]/n
+			if math.Abs(c-cov[a][b]) > 0.05 {
+				t.Errorf("covariance [%d][%d]: got %f, want %f", a, b, c, cov[a][b])
+			}
+		}
+	}
+}
+
+func TestSamplerz2DInvalid(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, cov := range [][2][2]float64{
+		{{3, 0.8}, {0.7, 2.5}},       // not symmetric
+		{{1, 2}, {2, 1}},             // indefinite
+		{{2.5, 0}, {0, -2.5}},        // negative
+		{{2.5, 0}, {0, 0}},           // singular
+		{{2.5, 0}, {0, math.NaN()}},  // NaN
+		{{math.Inf(1), 0}, {0, 2.5}}, // infinite
+		{{2.5, 0}, {0, 9}},           // sigma too large
+		{{2.5, 1.5}, {1.5, 2.5}},     // conditional sigma too small
+	} {
+		if _, err := sp.Samplerz2D([2]float64{}, cov, 1.28); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("covariance %v: got %v, want ErrInvalidSigma", cov, err)
+		}
+	}
+}
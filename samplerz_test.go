@@ -1,8 +1,22 @@
 package sampler
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/holiman/uint256"
 )
 
 var testSeed = []byte("FastFourierlattice-basedcompactsignaturesoverNTRU") // :)
@@ -24,8 +38,7 @@ func samplerKATunmarshal(testKAT []byte) []SamplerKAT {
 	return kat
 }
 
-func TestSamplerzKAT(t *testing.T) {
-	var samplerKAT512 = []byte(`
+var samplerKAT512 = []byte(`
 	[
     {
         "mu":-91.90471153063714,
@@ -7196,7 +7209,7 @@ func TestSamplerzKAT(t *testing.T) {
         "z":629
     }]`)
 
-	var samplerKAT1024 = []byte(`
+var samplerKAT1024 = []byte(`
 	[
     {
         "mu":23.440800716087555,
@@ -21536,6 +21549,12 @@ func TestSamplerzKAT(t *testing.T) {
     }
 	]`)
 
+// samplerKATs returns the Falcon-512 and Falcon-1024 KATs.
+func samplerKATs() []SamplerKAT {
+	return append(samplerKATunmarshal(samplerKAT512), samplerKATunmarshal(samplerKAT1024)...)
+}
+
+func TestSamplerzKAT(t *testing.T) {
 	KATS512 := samplerKATunmarshal(samplerKAT512)
 	KATS1024 := samplerKATunmarshal(samplerKAT1024)
 
@@ -21561,13 +21580,1332 @@ func TestSamplerzKAT(t *testing.T) {
 
 }
 
+// diffSamplers checks that a and b draw the same n samples, over a range of
+// centers and of Falcon-512 and Falcon-1024 parameters.
+func diffSamplers(t *testing.T, a, b *Sampler, n int) {
+	t.Helper()
+	params := []struct{ sigma, sigmin float64 }{
+		{1.7037990414754918, 1.2778336969128337},
+		{1.2778336969128337 + 1e-9, 1.2778336969128337},
+		{1.8, 1.2778336969128337},
+		{1.3052985443865464, 1.298280334344292},
+	}
+	for i := 0; i < n; i++ {
+		p := params[i%len(params)]
+		mu := float64(i%257) - 128 + float64(i)/float64(n)
+		za, errA := a.SamplerzErr(mu, p.sigma, p.sigmin)
+		zb, errB := b.SamplerzErr(mu, p.sigma, p.sigmin)
+		if za != zb || (errA == nil) != (errB == nil) {
+			t.Fatalf("sample %d (mu %v, sigma %v): got %d (%v) and %d (%v)", i, mu, p.sigma, za, errA, zb, errB)
+		}
+	}
+}
+
 func BenchmarkSamplerz(b *testing.B) {
 	mu := 217.87844009133536
 	sigma := 1.3052985443865464
 	sigmin := 1.298280334344292
 	shake := fromSeedSHAKE(testSeed)
 	sp := newsampler(shake)
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		sp.Samplerz(mu, sigma, sigmin)
 	}
 }
+
+func BenchmarkBerExp(b *testing.B) {
+	sp := NewSamplerFromSeed(testSeed)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sp.BerExp(0.3, 0.75)
+	}
+}
+
+// TestSamplerzAllocs is the allocation budget of the sampling hot path: none
+// once the sampler is built, with any option but WithReadTimeout, whose
+// bounded reads run in their own goroutine.
+func TestSamplerzAllocs(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"read buffer", []Option{WithReadBuffer(256)}},
+		{"constant time", []Option{WithConstantTimeBaseSampler(), WithConstantTimeBerExp()}},
+		{"fixed point", []Option{WithFixedPointExponent()}},
+		{"exp cache", []Option{WithExpCache(64)}},
+		{"scale", []Option{WithApproxExpScale(1 << 50)}},
+		{"rejection cap", []Option{WithAdaptiveRejectionCap(8)}},
+	} {
+		sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), tc.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, f := range map[string]func(){
+			"Samplerz":  func() { sp.Samplerz(-3.4, 1.7, 1.28) },
+			"BerExp":    func() { sp.BerExp(0.3, 0.75) },
+			"ApproxExp": func() { sp.ApproxExp(0.3, 0.75) },
+		} {
+			if n := testing.AllocsPerRun(1000, f); n != 0 {
+				t.Errorf("%s: %s allocates %v times per call", tc.name, name, n)
+			}
+		}
+	}
+	sp := NewSamplerFromSeed(testSeed)
+	if n := testing.AllocsPerRun(1000, func() { sp.Samplerz(-3.4, 1.7, 1.28) }); n != 0 {
+		t.Errorf("NewSamplerFromSeed: Samplerz allocates %v times per call", n)
+	}
+}
+
+func TestBerExpThresholdZ(t *testing.T) {
+	cached, err := NewSamplerWithOptions(nil, WithExpCache(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sp := range []*Sampler{newsampler(nil), cached} {
+		for i := 0; i <= 200; i++ {
+			x := float64(i) / 17
+			for _, ccs := range []float64{0, 0.01, 0.5, 0.7892, 1} {
+				zccs := sp.fixedCCS(ccs)
+				if got, want := sp.berexpThresholdZ(x, ccs, zccs), sp.berexpThreshold(x, ccs); got != want {
+					t.Fatalf("threshold(%v, %v) = %#x with a precomputed ccs, want %#x", x, ccs, got, want)
+				}
+				r := min(x, LN2)
+				if got, want := sp.approxexpFixed(uint64(r*(1<<63)), zccs), sp.approxexp(r, ccs); got != want {
+					t.Fatalf("approxexpFixed(%v, %v) = %#x, want %#x", r, ccs, got, want)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkSamplerzRejectionHeavy takes about 1.7 trials per sample, each
+// reusing the fixed-point ccs of the sample.
+func BenchmarkSamplerzRejectionHeavy(b *testing.B) {
+	const mu, sigma, sigmin = 0.37, 1.8, 1.28
+	sp := NewSamplerFromSeed(testSeed)
+	b.ReportMetric(ExpectedIterations(sigma, sigmin), "trials/op")
+	for i := 0; i < b.N; i++ {
+		sp.Samplerz(mu, sigma, sigmin)
+	}
+}
+
+func BenchmarkSamplerzFromSeed(b *testing.B) {
+	mu := 217.87844009133536
+	sigma := 1.3052985443865464
+	sigmin := 1.298280334344292
+	for _, bc := range []struct {
+		name string
+		sp   *Sampler
+	}{
+		{"Buffered", NewSamplerFromSeed(testSeed)},
+		{"Unbuffered", newsampler(fromSeedSHAKE(testSeed))},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bc.sp.Samplerz(mu, sigma, sigmin)
+			}
+		})
+	}
+}
+
+func TestReseedConcurrent(t *testing.T) {
+	mu := -8.322564895434937
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	sp := newsampler(fromSeedSHAKE(testSeed))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10000; i++ {
+			sp.Samplerz(mu, sigma, sigmin)
+		}
+	}()
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		default:
+			sp.Reseed([]byte{byte(i), byte(i >> 8)})
+		}
+	}
+}
+
+func TestSamplerzOffset(t *testing.T) {
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for _, tc := range []struct {
+		mu    float64
+		round int
+	}{
+		{0, 0}, {12, 12}, {-91.90471153063714, -92}, {7.2, 7},
+		{2.5, 3}, {-2.5, -3}, {-0.5, -1}, {0.49999999999999994, 0},
+	} {
+		for i := 0; i < 100; i++ {
+			got := sp.SamplerzOffset(tc.mu, sigma, sigmin)
+			if want := ref.Samplerz(tc.mu, sigma, sigmin) - tc.round; got != want {
+				t.Fatalf("mu %v: got offset %d, want %d", tc.mu, got, want)
+			}
+		}
+	}
+}
+
+func TestSamplerzCheckedSubnormal(t *testing.T) {
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	subnormals := []float64{
+		math.Float64frombits(1),
+		math.Float64frombits(0x000FFFFFFFFFFFFF),
+		-math.Float64frombits(0x0000000000000100),
+	}
+
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, v := range subnormals {
+		if _, err := sp.SamplerzChecked(0, v, sigmin); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("sigma %v: got %v, want ErrInvalidSigma", v, err)
+		}
+		if _, err := sp.SamplerzChecked(0, sigma, v); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("sigmin %v: got %v, want ErrInvalidSigma", v, err)
+		}
+	}
+
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		mu := subnormals[i%len(subnormals)]
+		z, err := sp.SamplerzChecked(mu, sigma, sigmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ref.SamplerzChecked(0, sigma, sigmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z != want {
+			t.Fatalf("mu %v: got %d, want %d as for mu = 0", mu, z, want)
+		}
+	}
+}
+
+func TestSamplerzCheckedInvalidSigma(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, tc := range []struct{ sigma, sigmin float64 }{
+		{1.7, 1}, {1.7, 0.5}, {1.2, 1.3}, {1.3, 1.3}, {1.8205, 1.3}, {2, 1.3}, {0, 0}, {-1.5, 1.2},
+	} {
+		if _, err := sp.SamplerzChecked(0, tc.sigma, tc.sigmin); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("sigma %v, sigmin %v: got %v, want ErrInvalidSigma", tc.sigma, tc.sigmin, err)
+		}
+	}
+}
+
+func TestBaseSamplerMax(t *testing.T) {
+	if BaseSamplerMax != len(RCDT) {
+		t.Fatalf("BaseSamplerMax = %d, want len(RCDT) = %d", BaseSamplerMax, len(RCDT))
+	}
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	if got := sp.MaxBaseSample(); got != BaseSamplerMax {
+		t.Errorf("MaxBaseSample() = %d, want %d", got, BaseSamplerMax)
+	}
+	for i := 0; i < 100000; i++ {
+		z0, err := sp.baseSampler()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if z0 < 0 || z0 > BaseSamplerMax {
+			t.Fatalf("base sample %d out of [0, %d]", z0, BaseSamplerMax)
+		}
+	}
+	// The all-zero uniform value is below every entry.
+	sp = newsampler(bytesReader(make([]byte, RCDTprecLen)))
+	if z0, err := sp.baseSampler(); err != nil || z0 != BaseSamplerMax {
+		t.Errorf("base sample of 0 = %d, %v, want %d", z0, err, BaseSamplerMax)
+	}
+
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err = NewSamplerWithTable(nil, table, 3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sp.MaxBaseSample(); got != len(table) {
+		t.Errorf("MaxBaseSample() with a custom table = %d, want %d", got, len(table))
+	}
+}
+
+// TestRoundingSensitivity replays the floating-point computations of
+// samplerz and berexp on the inputs met by the KAT vectors, once with
+// math/big in round-to-nearest-even, the mode of float64 arithmetic in Go,
+// and once in round-toward-zero, as an FPU left in that mode would compute.
+//
+// Findings:
+//   - The scalings by powers of two (x * 2^63, ccs * 2^63) are exact, so
+//     insensitive to the mode; only the conversions to uint64, which always
+//     truncate, round.
+//   - The fractional part r = mu - floor(mu) is exact for mu >= 0 (by
+//     Sterbenz's lemma for mu >= 1), but rounded for negative mu, where
+//     2 of the 3072 KAT centers get another r toward zero.
+//   - math.Pow(d, 2) is the correctly rounded square, so the native x matches
+//     the round-to-nearest replay bit for bit.
+//   - x = (z - r)^2 * dss - z0^2 * inv2sigma2, with dss = 1 / (2 * sigma^2),
+//     does five rounded operations and differs by a few ulps between the
+//     modes, up to about a hundred when the subtraction cancels. So do
+//     s * LN2 and x - s * LN2 in berexp, while floor(x * ILN2) changes
+//     only when x * ILN2 is within an ulp of an integer, which it never is
+//     here.
+//   - In the end the acceptance probability computed by approxexp moves by
+//     less than 2^-43, which bounds the probability that the rounding mode
+//     flips an acceptance decision of a trial.
+func TestRoundingSensitivity(t *testing.T) {
+	op := func(mode big.RoundingMode, f func(z, x, y *big.Float) *big.Float, a, b float64) float64 {
+		z := new(big.Float).SetPrec(53).SetMode(mode)
+		v, _ := f(z, big.NewFloat(a), big.NewFloat(b)).Float64()
+		return v
+	}
+	// x of samplerz, rounded with mode.
+	trialX := func(mode big.RoundingMode, z, r, sigma float64, z0 int) float64 {
+		dss := op(mode, (*big.Float).Quo, 1, op(mode, (*big.Float).Mul, 2*sigma, sigma))
+		d := op(mode, (*big.Float).Sub, z, r)
+		a := op(mode, (*big.Float).Mul, op(mode, (*big.Float).Mul, d, d), dss)
+		b := op(mode, (*big.Float).Mul, float64(z0*z0), inv2sigma2)
+		return op(mode, (*big.Float).Sub, a, b)
+	}
+	// r and s of berexp, rounded with mode.
+	reduce := func(mode big.RoundingMode, x float64) (float64, float64) {
+		s := math.Floor(op(mode, (*big.Float).Mul, x, ILN2))
+		return op(mode, (*big.Float).Sub, x, op(mode, (*big.Float).Mul, s, LN2)), s
+	}
+	ulps := func(a, b float64) float64 {
+		return math.Abs(a-b) / (math.Nextafter(math.Abs(a), math.Inf(1)) - math.Abs(a))
+	}
+
+	sp := newsampler(nil)
+	var maxULPs, maxDiff float64
+	var rChanges, sChanges int
+	for _, v := range samplerKATs() {
+		r := v.Mu - math.Floor(v.Mu)
+		rToZero := op(big.ToZero, (*big.Float).Sub, v.Mu, math.Floor(v.Mu))
+		if v.Mu >= 0 && rToZero != r {
+			t.Fatalf("mu - floor(mu) is not exact for mu = %v", v.Mu)
+		}
+		if rToZero != r {
+			rChanges++
+		}
+		ccs := v.Sigmin / v.Sigma
+		if op(big.ToZero, (*big.Float).Mul, ccs, 1<<63) != ccs*(1<<63) {
+			t.Fatalf("ccs * 2^63 is not exact for ccs = %v", ccs)
+		}
+		dss := 1 / (2 * v.Sigma * v.Sigma)
+		for z0 := 0; z0 <= BaseSamplerMax; z0++ {
+			for b := 0; b < 2; b++ {
+				z := float64(b + (2*b-1)*z0)
+				x := math.Pow((z-r), 2)*dss - math.Pow(float64(z0), 2)*inv2sigma2
+				if near := trialX(big.ToNearestEven, z, r, v.Sigma, z0); near != x {
+					t.Fatalf("native x = %v, round-to-nearest replay = %v", x, near)
+				}
+				if x < 0 {
+					continue
+				}
+				xz := trialX(big.ToZero, z, rToZero, v.Sigma, z0)
+				if x != 0 {
+					maxULPs = max(maxULPs, ulps(x, xz))
+				}
+
+				rn, sn := reduce(big.ToNearestEven, x)
+				rz, sz := reduce(big.ToZero, xz)
+				if op(big.ToZero, (*big.Float).Mul, rz, 1<<63) != rz*(1<<63) {
+					t.Fatalf("r * 2^63 is not exact for r = %v", rz)
+				}
+				if sn != sz {
+					sChanges++
+					continue
+				}
+				en, ez := sp.approxexp(rn, ccs), sp.approxexp(rz, ccs)
+				if (2*en-1)>>int(min(sn, 63)) != sp.berexpThreshold(x, ccs) {
+					t.Fatalf("berexp threshold replay mismatch for x = %v", x)
+				}
+				maxDiff = max(maxDiff, math.Abs(float64(en)-float64(ez))/(1<<63))
+			}
+		}
+	}
+	t.Logf("mu - floor(mu): %d of %d KAT centers change", rChanges, len(samplerKATs()))
+	t.Logf("x: up to %.0f ulps between the modes", maxULPs)
+	t.Logf("floor(x / ln 2): %d changes", sChanges)
+	t.Logf("approxexp: divergence up to 2^%.1f", math.Log2(maxDiff))
+	if sChanges != 0 {
+		t.Errorf("floor(x / ln 2) changed %d times with the rounding mode", sChanges)
+	}
+	if maxDiff > 0x1p-40 {
+		t.Errorf("approxexp diverges by %g, want <= 2^-40", maxDiff)
+	}
+}
+
+func TestSamplerzNonFiniteExponent(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	// mu passes checkSigma, but r = mu - floor(mu) is NaN.
+	for _, mu := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := sp.SamplerzChecked(mu, 1.5, 1.28); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("mu = %v: got %v, want ErrInvalidSigma", mu, err)
+		}
+	}
+	// sigma = 0 is rejected by checkSigma; on the unchecked path dss is
+	// infinite and x is NaN for z = 0, or infinite otherwise.
+	if _, _, err := sp.samplerz(0.5, 0, 1.28); !errors.Is(err, ErrInvalidSigma) {
+		t.Errorf("sigma = 0: got %v, want ErrInvalidSigma", err)
+	}
+	if _, _, err := sp.samplerz(0, 0, 1.28); !errors.Is(err, ErrInvalidSigma) {
+		t.Errorf("sigma = 0, mu = 0: got %v, want ErrInvalidSigma", err)
+	}
+}
+
+// TestSamplerzCenters checks that s + z is the sample for negative centers,
+// centers at and around integers and large centers: shifting the center by
+// an integer k shifts the sample drawn from the same randomness by k.
+func TestSamplerzCenters(t *testing.T) {
+	for _, frac := range []float64{0, 0.25, 0.5, 0.75, 0x1p-20, 1 - 0x1p-20} {
+		for _, k := range []float64{0, 1, -1, -2, 7, -1000, 1 << 20, -(1 << 31), 1 << 40, -(1 << 45), 1 << 52} {
+			if math.Abs(k) > 1<<30 && MaxCenter < 1<<53 {
+				continue // 32-bit int
+			}
+			mu := k + frac
+			if mu-k != frac {
+				continue // frac rounded away at this magnitude
+			}
+			sp := newsampler(fromSeedSHAKE(testSeed))
+			ref := newsampler(fromSeedSHAKE(testSeed))
+			for i := 0; i < 200; i++ {
+				z, err := sp.SamplerzErr(mu, 1.7, 1.28)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := ref.Samplerz(frac, 1.7, 1.28) + int(k); z != want {
+					t.Fatalf("mu = %v: got %d, want %d", mu, z, want)
+				}
+			}
+		}
+	}
+
+	// Just below an integer, mu is in the cell below it.
+	for _, mu := range []float64{-0x1p-52, math.Nextafter(-3, -4), math.Nextafter(5, 0)} {
+		sp := newsampler(fromSeedSHAKE(testSeed))
+		ref := newsampler(fromSeedSHAKE(testSeed))
+		for i := 0; i < 200; i++ {
+			if z, want := sp.Samplerz(mu, 1.7, 1.28), ref.Samplerz(mu-math.Floor(mu), 1.7, 1.28)+int(math.Floor(mu)); z != want {
+				t.Fatalf("mu = %v: got %d, want %d", mu, z, want)
+			}
+		}
+	}
+
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, mu := range []float64{MaxCenter, -MaxCenter} {
+		if _, err := sp.SamplerzErr(mu, 1.7, 1.28); err != nil {
+			t.Errorf("mu = %v: %v", mu, err)
+		}
+	}
+	for _, mu := range []float64{math.Nextafter(MaxCenter, math.Inf(1)), -2 * MaxCenter, 1e300} {
+		if _, err := sp.SamplerzErr(mu, 1.7, 1.28); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("mu = %v: got %v, want ErrInvalidSigma", mu, err)
+		}
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	diffSamplers(t, NewSampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed)), 1000)
+	diffSamplers(t, NewSamplerFromSeed(testSeed), newsampler(fromSeedSHAKE(testSeed)), 1000)
+}
+
+// failingReader returns its bytes, then err.
+type failingReader struct {
+	b   []byte
+	err error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if len(fr.b) == 0 {
+		return 0, fr.err
+	}
+	n := copy(p, fr.b)
+	fr.b = fr.b[n:]
+	return n, nil
+}
+
+func TestNewSamplerAllocs(t *testing.T) {
+	r := fromSeedSHAKE(testSeed)
+	// The sampler, its scratch value, its source, the read buffers and the
+	// rescaled coefficients of approxexp.
+	if n := testing.AllocsPerRun(100, func() { newsampler(r) }); n > 5 {
+		t.Errorf("newsampler allocates %v times, want at most 5", n)
+	}
+
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wide, err := NewSamplerWithOptions(r, WithTable(table, 3, 80))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := testing.AllocsPerRun(100, func() { WithTable(table, 3, 80)(wide) }); n > 1+float64(len(table))+1 {
+		t.Errorf("WithTable allocates %v times, want at most %d", n, 1+len(table)+1)
+	}
+
+	// The read buffers are disjoint, each capped to its length, including
+	// those of a table of another precision.
+	for _, tc := range []struct {
+		sp        *Sampler
+		precBytes int
+	}{{newsampler(r), int(RCDTprecLen)}, {wide, 10}} {
+		bufs := [][]byte{tc.sp.baseSamplerRB, tc.sp.samplerzRB, tc.sp.berexpRB, tc.sp.berexpCTRB}
+		for i, want := range []int{tc.precBytes, 1, 1, 8} {
+			if len(bufs[i]) != want || cap(bufs[i]) != want {
+				t.Errorf("%d-byte table: read buffer %d of length %d and capacity %d, want %d", tc.precBytes, i, len(bufs[i]), cap(bufs[i]), want)
+			}
+		}
+		for i, b := range bufs {
+			for j := range b {
+				b[j] = byte(i + 1)
+			}
+		}
+		for i, b := range bufs {
+			for _, c := range b {
+				if c != byte(i+1) {
+					t.Fatalf("%d-byte table: read buffer %d overwritten by another one", tc.precBytes, i)
+				}
+			}
+		}
+	}
+}
+
+func TestSamplerzErr(t *testing.T) {
+	errTransient := errors.New("transient failure")
+	for _, v := range samplerKATs()[:32] {
+		octets := decodeHexString(v.Octets)
+		// Failing at every read: base sampler, sign byte and berexp.
+		for n := 0; n < len(octets); n++ {
+			sp := newsampler(&failingReader{b: octets[:n], err: errTransient})
+			_, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+			if !errors.Is(err, ErrRNG) || !errors.Is(err, errTransient) {
+				t.Fatalf("failure after %d of %d bytes: got %v, want ErrRNG wrapping the cause", n, len(octets), err)
+			}
+			// The sampler remains usable with another source.
+			sp.Reseed(testSeed)
+			if _, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sp := newsampler(&failingReader{b: octets, err: errTransient})
+		if z, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin); err != nil || z != v.Z {
+			t.Fatalf("got %d, %v, want %d", z, err, v.Z)
+		}
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrRNG) {
+			t.Errorf("Samplerz panicked with %v, want ErrRNG", err)
+		}
+	}()
+	newsampler(bytesReader(nil)).Samplerz(0, 1.7, 1.28)
+	t.Error("Samplerz did not panic")
+}
+
+// cancellingReader cancels a context on its first read.
+type cancellingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c cancellingReader) Read(p []byte) (int, error) {
+	c.cancel()
+	return c.r.Read(p)
+}
+
+func TestSamplerzContext(t *testing.T) {
+	ctx := context.Background()
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		z, err := sp.SamplerzContext(ctx, float64(i)/3, 1.7, 1.28)
+		if want := ref.Samplerz(float64(i)/3, 1.7, 1.28); err != nil || z != want {
+			t.Fatalf("sample %d: got %d, %v, want %d", i, z, err, want)
+		}
+	}
+
+	// Cancelled during the first trial: only a sample accepted at the first
+	// trial is returned.
+	for _, v := range samplerKATs()[:64] {
+		octets := decodeHexString(v.Octets)
+		_, iterations, err := newsampler(bytesReader(octets)).samplerz(v.Mu, v.Sigma, v.Sigmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		sp := newsampler(cancellingReader{bytesReader(octets), cancel})
+		z, err := sp.SamplerzContext(ctx, v.Mu, v.Sigma, v.Sigmin)
+		if iterations == 1 && (err != nil || z != v.Z) {
+			t.Errorf("got %d, %v, want %d", z, err, v.Z)
+		}
+		if iterations > 1 && err != context.Canceled {
+			t.Errorf("got %d, %v, want context.Canceled", z, err)
+		}
+	}
+
+	// Done before the first trial: nothing is read.
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	sp, c := NewSamplerCounting(fromSeedSHAKE(testSeed))
+	if _, err := sp.SamplerzContext(ctx, 0, 1.7, 1.28); !errors.Is(err, context.DeadlineExceeded) || c.BytesRead() != 0 {
+		t.Errorf("got %v after %d bytes, want context.DeadlineExceeded", err, c.BytesRead())
+	}
+}
+
+func TestRCDTSpec(t *testing.T) {
+	if len(RCDT) != len(rcdtSpec) {
+		t.Fatalf("RCDT has %d entries, want %d", len(RCDT), len(rcdtSpec))
+	}
+	for i, s := range rcdtSpec {
+		want, err := uint256.FromDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !RCDT[i].Eq(want) {
+			t.Errorf("RCDT[%d] = %s, want %s", i, RCDT[i].Dec(), s)
+		}
+	}
+}
+
+func TestNewBigNumFromHexInvalid(t *testing.T) {
+	for _, s := range []string{"0x1F80D88A7B64y28", "1F80D88A7B6428", "0x", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewBigNumFromHex(%q) did not panic", s)
+				}
+			}()
+			NewBigNumFromHex(s)
+		}()
+	}
+}
+
+// berexpThresholdRef computes z = (2 · ApproxExp(r, ccs) − 1) >> s of the
+// specification with math/big, independently of uint256. As in the Python
+// reference, r is converted to a signed integer, so that a reduced argument
+// rounded slightly below 0 stays close to 0.
+func berexpThresholdRef(x, ccs float64) uint64 {
+	s := math.Floor(x * ILN2)
+	r := x - s*LN2
+	s = min(s, 63)
+	y := new(big.Int).SetUint64(C[0].Uint64())
+	z := big.NewInt(int64(r * (1 << 63)))
+	for _, elt := range C[1:] {
+		y.Mul(z, y).Rsh(y, 63)
+		y.Sub(new(big.Int).SetUint64(elt.Uint64()), y)
+	}
+	y.Mul(new(big.Int).SetUint64(uint64(ccs*(1<<63))), y).Rsh(y, 63)
+	y.Lsh(y, 1).Sub(y, big.NewInt(1))
+	if y.Sign() < 0 {
+		return 0
+	}
+	return y.Rsh(y, uint(s)).Uint64()
+}
+
+// TestBerExpReductionBoundary checks berexp around the multiples of LN2,
+// where the reduced argument r rounds to slightly below 0 or above LN2.
+func TestBerExpReductionBoundary(t *testing.T) {
+	sp := newsampler(nil)
+	for s := 0.0; s <= 70; s++ {
+		for _, x := range []float64{
+			math.Nextafter(s*LN2, 0), s * LN2, math.Nextafter(s*LN2, 100),
+			s*LN2 - 1e-12, s*LN2 + 1e-12,
+		} {
+			if x < 0 {
+				continue
+			}
+			for _, ccs := range []float64{1, 0.6} {
+				got, want := sp.berexpThreshold(x, ccs), berexpThresholdRef(x, ccs)
+				// Without the clamp, an r below 0 wraps around to a threshold several
+				// times too small.
+				if d := max(got, want) - min(got, want); d > want>>32+1 {
+					t.Errorf("threshold(%v, %v) = %#x, want %#x", x, ccs, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestApproxExpErrorBound checks approxexp against 2^63 · ccs · exp(−x) over
+// a dense grid of [0, ln(2)] × [0, 1], within the relative error 2^-47 of the
+// polynomial, plus 2 for the truncations of the products by ccs. math.Exp
+// is within 1 ulp, far below the bound.
+func TestApproxExpErrorBound(t *testing.T) {
+	sp := newsampler(nil)
+	rng := rand.New(rand.NewSource(1))
+	var worst float64 // the largest error, as a fraction of the bound
+	for i := 0; i <= 20000; i++ {
+		x := LN2 * float64(i) / 20000
+		for j := 0; j <= 40; j++ {
+			ccs := float64(j) / 40
+			if j%2 == 1 {
+				ccs = rng.Float64()
+			}
+			want := new(big.Float).SetFloat64(ccs * math.Exp(-x))
+			want.SetMantExp(want, 63)
+			got := new(big.Float).SetUint64(sp.approxexp(x, ccs))
+			d, _ := new(big.Float).Sub(got, want).Float64()
+			w, _ := want.Float64()
+			if bound := w*0x1p-47 + 2; math.Abs(d) > bound {
+				t.Fatalf("approxexp(%v, %v) is off by %v, want at most %v", x, ccs, d, bound)
+			}
+			worst = max(worst, math.Abs(d)/(w*0x1p-47+2))
+		}
+	}
+	t.Logf("largest error: %.3f of the bound", worst)
+}
+
+func TestApproxExpCCSRange(t *testing.T) {
+	for _, scale := range []uint64{1 << 63, 1 << 40} {
+		sp, err := NewSamplerWithOptions(nil, WithApproxExpScale(scale))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range []float64{0, 0.3, LN2} {
+			one := sp.approxexp(x, 1)
+			below := sp.approxexp(x, math.Nextafter(1, 0))
+			if want := math.Exp(-x) * 0x1p63; math.Abs(float64(one)-want) > want*0x1p-30 {
+				t.Errorf("scale %#x: approxexp(%v, 1) = %#x, want about %v", scale, x, one, want)
+			}
+			if below > one || one-below > one>>40+2*(1<<63/scale) {
+				t.Errorf("scale %#x: approxexp(%v, 1 - ulp) = %#x, approxexp(%v, 1) = %#x", scale, x, below, x, one)
+			}
+			// Out of range, ccs is clamped into [0, 1].
+			for _, ccs := range []float64{1.5, 2, 1e30, math.Inf(1)} {
+				if y := sp.approxexp(x, ccs); y != one {
+					t.Errorf("scale %#x: approxexp(%v, %v) = %#x, want %#x", scale, x, ccs, y, one)
+				}
+			}
+			for _, ccs := range []float64{0, -1, math.NaN(), math.Inf(-1)} {
+				if y := sp.approxexp(x, ccs); y != 0 {
+					t.Errorf("scale %#x: approxexp(%v, %v) = %#x, want 0", scale, x, ccs, y)
+				}
+			}
+		}
+		if y := sp.approxexp(0, 1); y != 1<<63 {
+			t.Errorf("scale %#x: approxexp(0, 1) = %#x, want 2^63", scale, y)
+		}
+	}
+	// For x = 0 and ccs = 1, the threshold is 2^64 - 1: berexp only rejects
+	// the all-ones uniform.
+	sp := newsampler(nil)
+	if z := sp.berexpThreshold(0, 1); z != math.MaxUint64 {
+		t.Errorf("threshold(0, 1) = %#x, want 2^64 - 1", z)
+	}
+	for _, last := range []byte{0xfe, 0xff} {
+		sp.SetReader(bytesReader(append(bytes.Repeat([]byte{0xff}, 7), last)))
+		if accept, err := sp.berexp(0, 1); err != nil || accept != (last == 0xfe) {
+			t.Errorf("berexp(0, 1) on ff..%x: got %v, %v", last, accept, err)
+		}
+	}
+}
+
+func TestBerExpReference(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i <= 400; i++ {
+		x := float64(i) / 20
+		for j := 0; j <= 20; j++ {
+			ccs := float64(j) / 20
+			if got, want := sp.berexpThreshold(x, ccs), berexpThresholdRef(x, ccs); got != want {
+				t.Fatalf("berexp threshold(%v, %v) = %#x, want %#x", x, ccs, got, want)
+			}
+		}
+	}
+
+	// The acceptance rate is ccs · exp(−x).
+	for _, p := range []struct{ x, ccs float64 }{{0, 1}, {0.3, 0.75}, {1.9, 0.9}, {4, 0.5}} {
+		const n = 200000
+		var accepted int
+		for i := 0; i < n; i++ {
+			accept, err := sp.berexp(p.x, p.ccs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accept {
+				accepted++
+			}
+		}
+		want := p.ccs * math.Exp(-p.x)
+		if got := float64(accepted) / n; math.Abs(got-want) > 4*math.Sqrt(want*(1-want)/n)+1e-9 {
+			t.Errorf("berexp(%v, %v) accepts with rate %f, want %f", p.x, p.ccs, got, want)
+		}
+	}
+}
+
+func TestBerExpLoopBoundaries(t *testing.T) {
+	const x, ccs = 0.3, 0.75
+	sp := newsampler(nil)
+	z := sp.berexpThreshold(x, ccs)
+	var zb [8]byte
+	binary.BigEndian.PutUint64(zb[:], z)
+	// berexp on u, which must be consumed exactly.
+	run := func(u []byte) bool {
+		r := bytes.NewReader(u)
+		sp.rng.Store(sp.newSource(r))
+		accept, err := sp.berexp(x, ccs)
+		if err != nil {
+			t.Fatalf("berexp on %x: %v", u, err)
+		}
+		if r.Len() != 0 {
+			t.Fatalf("berexp on %x left %d bytes", u, r.Len())
+		}
+		return accept
+	}
+
+	// k leading bytes match z, and the byte of index k decides.
+	for k := 0; k < 8; k++ {
+		if zb[k] > 0 {
+			u := append(bytes.Clone(zb[:k]), zb[k]-1)
+			if !run(u) {
+				t.Errorf("byte %d below z: rejected %x", k, u)
+			}
+		}
+		if zb[k] < 0xFF {
+			u := append(bytes.Clone(zb[:k]), zb[k]+1)
+			if run(u) {
+				t.Errorf("byte %d above z: accepted %x", k, u)
+			}
+		}
+	}
+	// Equal to z: rejected after the 8 bytes, without drawing a ninth one.
+	if run(zb[:]) {
+		t.Errorf("accepted u = z = %x", zb)
+	}
+}
+
+func TestBernoulliBytes(t *testing.T) {
+	// Every byte of z is compared on its own: z >> i has higher bytes set
+	// for i < 56, which must not take part in the comparison.
+	const z = 0x0102030405060708
+	for _, tc := range []struct {
+		u      []byte
+		accept bool
+	}{
+		{[]byte{0x00}, true},
+		{[]byte{0x02}, false},
+		{[]byte{0x01, 0x01}, true},
+		{[]byte{0x01, 0x03}, false},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x07}, true},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, false},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x09}, false},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x04}, true},
+	} {
+		r := bytes.NewReader(tc.u)
+		sp := newsampler(r)
+		accept, err := sp.bernoulli(z)
+		if err != nil {
+			t.Fatalf("bernoulli on %x: %v", tc.u, err)
+		}
+		if accept != tc.accept || r.Len() != 0 {
+			t.Errorf("bernoulli on %x: got %v with %d bytes left, want %v", tc.u, accept, r.Len(), tc.accept)
+		}
+		sp = newsampler(bytesReader(append(bytes.Clone(tc.u), make([]byte, 8-len(tc.u))...)))
+		if accept, err := sp.bernoulliCT(z); err != nil || accept != tc.accept {
+			t.Errorf("bernoulliCT on %x: got %v, %v, want %v", tc.u, accept, err, tc.accept)
+		}
+	}
+}
+
+func TestNewSecureSampler(t *testing.T) {
+	sp := NewSecureSampler()
+	var sum float64
+	const n = 10000
+	for i := 0; i < n; i++ {
+		z, err := sp.SamplerzErr(-3.25, 1.7, 1.28)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += float64(z)
+	}
+	if mean := sum / n; math.Abs(mean+3.25) > 0.1 {
+		t.Errorf("mean %f, want about -3.25", mean)
+	}
+}
+
+func TestMaxSigma(t *testing.T) {
+	if got := 1 / (2 * MAX_SIGMA * MAX_SIGMA); math.Abs(got-inv2sigma2) > 1e-16 {
+		t.Errorf("1 / (2 * MAX_SIGMA^2) = %v, want inv2sigma2 = %v", got, inv2sigma2)
+	}
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	if _, err := sp.SamplerzChecked(0, math.Nextafter(MAX_SIGMA, 0), 1.28); err != nil {
+		t.Errorf("sigma just below MAX_SIGMA: %v", err)
+	}
+	_, err := sp.SamplerzChecked(0, MAX_SIGMA, 1.28)
+	if !errors.Is(err, ErrInvalidSigma) || !strings.Contains(err.Error(), "1.8205") {
+		t.Errorf("sigma = MAX_SIGMA: got %v, want ErrInvalidSigma naming the bound", err)
+	}
+}
+
+func TestReseedSetReader(t *testing.T) {
+	a := newsampler(fromSeedSHAKE([]byte("a")))
+	b := newsampler(fromSeedSHAKE([]byte("b")))
+	a.Samplerz(0, 1.7, 1.28)
+	buf := a.baseSamplerRB
+
+	a.Reseed(testSeed)
+	b.Reseed(testSeed)
+	diffSamplers(t, a, b, 1000)
+	if &a.baseSamplerRB[0] != &buf[0] {
+		t.Error("Reseed reallocated the read buffers")
+	}
+
+	a.SetReader(fromSeedSHAKE(testSeed))
+	diffSamplers(t, a, newsampler(fromSeedSHAKE(testSeed)), 1000)
+	pn := &a.baseSamplerRB[0]
+	v := samplerKATs()[0]
+	a.SetReader(bytesReader(decodeHexString(v.Octets)))
+	if z := a.Samplerz(v.Mu, v.Sigma, v.Sigmin); z != v.Z {
+		t.Errorf("after SetReader: got %d, want %d", z, v.Z)
+	}
+	if &a.baseSamplerRB[0] != pn {
+		t.Error("SetReader reallocated the read buffers")
+	}
+}
+
+func TestReader(t *testing.T) {
+	c := NewCountingReader(fromSeedSHAKE(testSeed))
+	sp := newsampler(c)
+	if sp.Reader() != io.Reader(c) {
+		t.Fatalf("Reader() = %v, want the counting reader", sp.Reader())
+	}
+	for i := 0; i < 100; i++ {
+		sp.Samplerz(0.3, 1.7, 1.28)
+	}
+	checkpoint := sp.Reader().(*CountingReader).BytesRead()
+	if checkpoint == 0 {
+		t.Fatal("no bytes counted through Reader()")
+	}
+
+	// Swapping the reader changes the stream from the next sample on, and
+	// swapping it back resumes the first one where it stopped.
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 100; i++ {
+		ref.Samplerz(0.3, 1.7, 1.28)
+	}
+	other := fromSeedSHAKE([]byte("other"))
+	sp.SetReader(other)
+	if sp.Reader() != other {
+		t.Fatal("Reader() is not the reader given to SetReader")
+	}
+	var same int
+	otherRef := newsampler(fromSeedSHAKE([]byte("other")))
+	for i := 0; i < 100; i++ {
+		z := sp.Samplerz(0.3, 1.7, 1.28)
+		if want := otherRef.Samplerz(0.3, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d after the swap: got %d, want %d", i, z, want)
+		}
+		if z == ref.Samplerz(0.3, 1.7, 1.28) {
+			same++
+		}
+	}
+	if same > 60 {
+		t.Errorf("%d of 100 samples unchanged by the swap", same)
+	}
+	sp.SetReader(c)
+	ref = newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 100; i++ {
+		ref.Samplerz(0.3, 1.7, 1.28)
+	}
+	diffSamplers(t, sp, ref, 100)
+	if c.BytesRead() == checkpoint {
+		t.Error("the swapped-back reader was not read")
+	}
+}
+
+func TestNewSamplerFromBytes(t *testing.T) {
+	for _, v := range samplerKATs() {
+		octets := decodeHexString(v.Octets)
+		sp := NewSamplerFromBytes(octets)
+		if z, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin); err != nil || z != v.Z {
+			t.Fatalf("got %d, %v, want %d", z, err, v.Z)
+		}
+		// The vector is consumed exactly.
+		if _, err := sp.SamplerzErr(v.Mu, v.Sigma, v.Sigmin); !errors.Is(err, ErrRNG) || !errors.Is(err, io.EOF) {
+			t.Fatalf("sampling past the vector: got %v, want ErrRNG wrapping io.EOF", err)
+		}
+	}
+
+	// An under-provided vector fails cleanly, on a short read here.
+	_, err := NewSamplerFromBytes(make([]byte, RCDTprecLen-1)).SamplerzErr(0, 1.7, 1.28)
+	if !errors.Is(err, ErrRNG) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short vector: got %v, want ErrRNG wrapping io.ErrUnexpectedEOF", err)
+	}
+	if want := "sampler: randomness source failure: source exhausted: reading 9 bytes: unexpected EOF"; err.Error() != want {
+		t.Errorf("got message %q, want %q", err, want)
+	}
+}
+
+func TestErrEntropyExhausted(t *testing.T) {
+	for _, v := range samplerKATs()[:32] {
+		octets := decodeHexString(v.Octets)
+		for n := 0; n < len(octets); n++ {
+			_, err := NewSamplerFromBytes(octets[:n]).SamplerzErr(v.Mu, v.Sigma, v.Sigmin)
+			if !errors.Is(err, ErrEntropyExhausted) || !errors.Is(err, ErrRNG) {
+				t.Fatalf("%d of %d bytes: got %v, want ErrEntropyExhausted", n, len(octets), err)
+			}
+		}
+	}
+	// Other failures of the source are not exhaustion.
+	errTransient := errors.New("transient failure")
+	_, err := newsampler(&failingReader{err: errTransient}).SamplerzErr(0, 1.7, 1.28)
+	if !errors.Is(err, ErrRNG) || errors.Is(err, ErrEntropyExhausted) {
+		t.Errorf("transient failure: got %v, want ErrRNG only", err)
+	}
+}
+
+func TestSamplerzFrom(t *testing.T) {
+	sp := NewSamplerFromSeed(testSeed)
+	ref, other := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE([]byte("other")))
+	oneOff := fromSeedSHAKE([]byte("other"))
+	for i := 0; i < 500; i++ {
+		if z, want := sp.Samplerz(0.5, 1.7, 1.28), ref.Samplerz(0.5, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+		if z, want := sp.SamplerzFrom(oneOff, -3.2, 1.5, 1.28), other.Samplerz(-3.2, 1.5, 1.28); z != want {
+			t.Fatalf("sample %d from the one-off reader: got %d, want %d", i, z, want)
+		}
+	}
+
+	// The source is restored after a failure of the one-off reader.
+	func() {
+		defer func() {
+			if err, _ := recover().(error); !errors.Is(err, ErrEntropyExhausted) {
+				t.Errorf("got panic %v, want ErrEntropyExhausted", err)
+			}
+		}()
+		sp.SamplerzFrom(bytesReader(make([]byte, 5)), 0, 1.7, 1.28)
+	}()
+	diffSamplers(t, sp, ref, 100)
+
+	// Exactly the bytes used are read from the one-off reader.
+	c, used := NewCountingReader(fromSeedSHAKE(testSeed)), NewCountingReader(fromSeedSHAKE(testSeed))
+	sp.SamplerzFrom(c, 0, 1.7, 1.28)
+	newsampler(used).Samplerz(0, 1.7, 1.28)
+	if c.BytesRead() != used.BytesRead() {
+		t.Errorf("read %d bytes from the one-off reader, want %d", c.BytesRead(), used.BytesRead())
+	}
+}
+
+func TestClose(t *testing.T) {
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithReadBuffer(64), WithExpCache(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		sp.Samplerz(0.5, 1.7, 1.28)
+	}
+	// In case they happened to be 0, or were not drawn, as berexpCTRB
+	// without WithConstantTimeBerExp.
+	sp.berexpRB[0], sp.samplerzRB[0], sp.berexpCTRB[0] = 1, 1, 1
+	src := sp.rng.Load()
+	sp.Close()
+
+	for name, b := range map[string][]byte{
+		"baseSamplerRB": sp.baseSamplerRB,
+		"samplerzRB":    sp.samplerzRB,
+		"berexpRB":      sp.berexpRB,
+		"berexpCTRB":    sp.berexpCTRB,
+		"read buffer":   src.buf,
+	} {
+		if !bytes.Equal(b, make([]byte, len(b))) {
+			t.Errorf("%s not wiped: %x", name, b)
+		}
+	}
+	for _, e := range sp.expCache {
+		if e != (expCacheEntry{}) {
+			t.Errorf("exp cache not wiped: %+v", e)
+		}
+	}
+	if !sp.y.IsZero() {
+		t.Error("scratch value not wiped")
+	}
+	if _, err := sp.SamplerzErr(0.5, 1.7, 1.28); !errors.Is(err, ErrRNG) {
+		t.Errorf("sampling after Close: got %v, want ErrRNG", err)
+	}
+}
+
+func TestBerExpShiftClamp(t *testing.T) {
+	sp := newsampler(nil)
+	// With ccs = 1 and r = 0.1, 2 · ApproxExp(r, ccs) − 1 ≈ 1.81 · 2^63.
+	for _, tc := range []struct {
+		s    float64
+		want uint64
+	}{
+		{61, 7}, {62, 3}, {63, 1}, {64, 1}, {65, 1}, {1000, 1},
+	} {
+		x := tc.s*LN2 + 0.1
+		if s := math.Floor(x * ILN2); s != tc.s {
+			t.Fatalf("floor(%v / ln 2) = %v, want %v", x, s, tc.s)
+		}
+		if got := sp.berexpThreshold(x, 1); got != tc.want {
+			t.Errorf("s = %v: threshold %d, want %d", tc.s, got, tc.want)
+		}
+		if got := berexpThresholdRef(x, 1); got != tc.want {
+			t.Errorf("s = %v: reference threshold %d, want %d", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	for _, tc := range []struct{ v, want int }{{-5, 0}, {0, 0}, {7, 7}, {63, 63}, {64, 63}, {1 << 30, 63}} {
+		if got := Clamp(tc.v, 0, 63); got != tc.want {
+			t.Errorf("Clamp(%d, 0, 63) = %d, want %d", tc.v, got, tc.want)
+		}
+	}
+	for _, tc := range []struct{ v, want float64 }{{-1e-17, 0}, {math.Inf(-1), 0}, {0.5, 0.5}, {LN2, LN2}, {1, LN2}} {
+		if got := Clamp(tc.v, 0, LN2); got != tc.want {
+			t.Errorf("Clamp(%v, 0, ln 2) = %v, want %v", tc.v, got, tc.want)
+		}
+	}
+	if got := Clamp(math.NaN(), 0, 1); !math.IsNaN(got) {
+		t.Errorf("Clamp(NaN, 0, 1) = %v, want NaN", got)
+	}
+
+	// A negative x gives a negative s, which as a shift count would panic:
+	// it is clamped to 0, and x in [-ln 2, 0) behaves as x + ln 2.
+	sp := newsampler(nil)
+	for _, x := range []float64{-0.5, -0.1, -1e-9} {
+		if got, want := sp.berexpThreshold(x, 1), sp.berexpThreshold(x+LN2, 1); got != want {
+			t.Errorf("threshold(%v, 1) = %#x, want %#x", x, got, want)
+		}
+	}
+}
+
+func TestErrorReturningAPI(t *testing.T) {
+	// Every draw fails without a panic on a starved source.
+	short := func() *Sampler { return newsampler(bytesReader(make([]byte, 3))) }
+	if _, err := short().SamplerzErr(0.5, 1.7, 1.28); !errors.Is(err, ErrEntropyExhausted) {
+		t.Errorf("SamplerzErr: got %v", err)
+	}
+	if _, err := New(iotest.ErrReader(io.ErrClosedPipe)).SampleZErr(0.5, 1.7, 1.28); !errors.Is(err, ErrRNG) || !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("SampleZErr: got %v", err)
+	}
+	if _, err := short().BaseSamplerErr(); !errors.Is(err, ErrEntropyExhausted) {
+		t.Errorf("BaseSamplerErr: got %v", err)
+	}
+	if _, err := newsampler(bytesReader(nil)).BerExpErr(0.3, 0.75); !errors.Is(err, ErrEntropyExhausted) {
+		t.Errorf("BerExpErr: got %v", err)
+	}
+
+	// On a working source, they draw as the rest of the sampler.
+	sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 100; i++ {
+		z, err := sp.SampleZErr(-2.5, 1.7, 1.28)
+		if want := ref.Samplerz(-2.5, 1.7, 1.28); err != nil || z != want {
+			t.Fatalf("SampleZErr = %d, %v, want %d", z, err, want)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		z0, err := sp.BaseSamplerErr()
+		if want, _ := ref.baseSampler(); err != nil || z0 != want {
+			t.Fatalf("BaseSamplerErr = %d, %v, want %d", z0, err, want)
+		}
+		accept, err := sp.BerExpErr(0.3, 0.75)
+		if want := ref.BerExp(0.3, 0.75); err != nil || accept != want {
+			t.Fatalf("BerExpErr = %v, %v, want %v", accept, err, want)
+		}
+	}
+	ct, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithConstantTimeBaseSampler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref = newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		z0, err := ct.BaseSamplerErr()
+		if want, _ := ref.baseSamplerCT(); err != nil || z0 != want {
+			t.Fatalf("constant time: BaseSamplerErr = %d, %v, want %d", z0, err, want)
+		}
+	}
+}
+
+func TestSamplerzComponents(t *testing.T) {
+	sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+	var signs [2]int
+	for i := 0; i < 10000; i++ {
+		mu := float64(i)/37 - 100
+		center, magnitude, sign := sp.SamplerzComponents(mu, 1.7, 1.28)
+		want := ref.Samplerz(mu, 1.7, 1.28)
+		if center != int(math.Floor(mu)) || magnitude < 0 || magnitude > len(RCDT) || sign&1 != sign {
+			t.Fatalf("mu = %v: components %d, %d, %d", mu, center, magnitude, sign)
+		}
+		if z := center + sign + (2*sign-1)*magnitude; z != want {
+			t.Fatalf("mu = %v: components %d, %d, %d give %d, want %d", mu, center, magnitude, sign, z, want)
+		}
+		signs[sign]++
+	}
+	if signs[0] < 4500 || signs[1] < 4500 {
+		t.Errorf("sign bits %v, want about even", signs)
+	}
+	if sp.components != nil {
+		t.Error("components still recorded after SamplerzComponents")
+	}
+}
+
+func TestSamplerzInt64(t *testing.T) {
+	sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+	for _, mu := range []float64{0, -0.5, 3.25, 1<<31 + 0.75, -(1<<31 + 0.75), 1<<40 + 0.125, -(1<<52 + 0.5), 1 << 53, -(1 << 53)} {
+		for i := 0; i < 200; i++ {
+			z := sp.SamplerzInt64(mu, 1.7, 1.28)
+			// The offset from the center as a float64, exact for |mu| <= 2^53.
+			if d := float64(z) - mu; math.Abs(d) > 20 {
+				t.Fatalf("mu = %v: sample %d is %v away from the center", mu, z, d)
+			}
+			// The randomness and the offsets are those of Samplerz.
+			s := math.Floor(mu)
+			if want := ref.Samplerz(mu-s, 1.7, 1.28); z-int64(s) != int64(want) {
+				t.Fatalf("mu = %v: offset %d, want %d", mu, z-int64(s), want)
+			}
+		}
+	}
+	if strconv.IntSize == 64 {
+		sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+		for i := 0; i < 1000; i++ {
+			mu := float64(i)*1e9 + 0.3
+			if z, want := sp.SamplerzInt64(mu, 1.7, 1.28), ref.Samplerz(mu, 1.7, 1.28); z != int64(want) {
+				t.Fatalf("mu = %v: got %d, want the sample %d of Samplerz", mu, z, want)
+			}
+		}
+	}
+
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("center beyond 2^53: recovered %v, want ErrInvalidSigma", err)
+		}
+	}()
+	sp.SamplerzInt64(1<<54, 1.7, 1.28)
+}
+
+func TestSamplerzBig(t *testing.T) {
+	// Centers exact as a float64 give the samples of Samplerz.
+	sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 5000; i++ {
+		mu := float64(i)/7.3 - 300
+		if i%100 == 0 && MaxCenter == 1<<53 {
+			mu *= 1 << 30
+		}
+		if z, want := sp.SamplerzBig(big.NewFloat(mu), 1.7, 1.28), ref.Samplerz(mu, 1.7, 1.28); z != want {
+			t.Fatalf("mu = %v: got %d, want %d", mu, z, want)
+		}
+	}
+
+	// Beyond float64 precision, the fractional part is kept: 2^40 + 1/3 to
+	// 200 bits samples as 2^40 + Samplerz(1/3), where the float64 2^40 + 1/3
+	// would be off by 2^-14.
+	third := new(big.Float).SetPrec(200).Quo(big.NewFloat(1), big.NewFloat(3))
+	for _, k := range []int64{1 << 40, -(1 << 40), 0, -1} {
+		if k > MaxCenter || k < -MaxCenter {
+			continue // 32-bit int
+		}
+		mu := new(big.Float).SetPrec(200).Add(new(big.Float).SetInt64(k), third)
+		sp, ref := newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))
+		for i := 0; i < 200; i++ {
+			if z, want := sp.SamplerzBig(mu, 1.7, 1.28), int(k)+ref.Samplerz(1.0/3, 1.7, 1.28); z != want {
+				t.Fatalf("mu = %d + 1/3: got %d, want %d", k, z, want)
+			}
+		}
+	}
+
+	for _, mu := range []*big.Float{new(big.Float).SetInf(false), new(big.Float).SetFloat64(1 << 60)} {
+		func() {
+			defer func() {
+				if err, ok := recover().(error); !ok || !errors.Is(err, ErrInvalidSigma) {
+					t.Errorf("mu = %v: recovered %v, want ErrInvalidSigma", mu, err)
+				}
+			}()
+			sp.SamplerzBig(mu, 1.7, 1.28)
+		}()
+	}
+}
+
+func TestSigmaContext(t *testing.T) {
+	sc, err := NewSigmaContext(1.7, 1.28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Sigma() != 1.7 || sc.Sigmin() != 1.28 {
+		t.Errorf("SigmaContext of (%v, %v)", sc.Sigma(), sc.Sigmin())
+	}
+	capped, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithFixedPointExponent(), WithAdaptiveRejectionCap(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cappedRef, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithFixedPointExponent(), WithAdaptiveRejectionCap(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range [][2]*Sampler{
+		{newsampler(fromSeedSHAKE(testSeed)), newsampler(fromSeedSHAKE(testSeed))},
+		{capped, cappedRef},
+	} {
+		sp, ref := pair[0], pair[1]
+		for i := 0; i < 5000; i++ {
+			mu := float64(i)/13 - 200
+			if z, want := sp.SamplerzCtx(sc, mu), ref.Samplerz(mu, 1.7, 1.28); z != want {
+				t.Fatalf("mu = %v: got %d, want %d", mu, z, want)
+			}
+		}
+	}
+
+	for _, p := range [][2]float64{{1.7, 1}, {1.28, 1.28}, {1.2, 1.28}, {math.Inf(1), 1.28}, {math.NaN(), 1.28}, {1.7, math.NaN()}} {
+		if _, err := NewSigmaContext(p[0], p[1]); !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("sigma = %v, sigmin = %v: got %v, want ErrInvalidSigma", p[0], p[1], err)
+		}
+	}
+
+	// The bound of sigma is that of the table of the sampler.
+	wide, err := NewSigmaContext(2.5, 1.28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err := NewSamplerWithTable(fromSeedSHAKE(testSeed), table, 3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp.SamplerzCtx(wide, 0.5)
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrInvalidSigma) {
+			t.Errorf("sigma beyond the default table: recovered %v, want ErrInvalidSigma", err)
+		}
+	}()
+	newsampler(fromSeedSHAKE(testSeed)).SamplerzCtx(wide, 0.5)
+}
+
+func TestSamplerzNonFinite(t *testing.T) {
+	values := func(finite float64) []float64 {
+		return []float64{finite, math.NaN(), math.Inf(1), math.Inf(-1)}
+	}
+	for _, mu := range values(0.3) {
+		for _, sigma := range values(1.7) {
+			for _, sigmin := range values(1.28) {
+				if mu == 0.3 && sigma == 1.7 && sigmin == 1.28 {
+					continue
+				}
+				// A deadline turns a rejection loop that never ends into
+				// a failure instead of a hang.
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				sp := newsampler(fromSeedSHAKE(testSeed))
+				_, err := sp.SamplerzContext(ctx, mu, sigma, sigmin)
+				cancel()
+				if !errors.Is(err, ErrInvalidSigma) {
+					t.Errorf("Samplerz(%v, %v, %v): got %v, want ErrInvalidSigma", mu, sigma, sigmin, err)
+				}
+				if _, err := sp.SamplerzErr(mu, sigma, sigmin); !errors.Is(err, ErrInvalidSigma) {
+					t.Errorf("SamplerzErr(%v, %v, %v): got %v, want ErrInvalidSigma", mu, sigma, sigmin, err)
+				}
+			}
+		}
+	}
+}
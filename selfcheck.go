@@ -0,0 +1,11 @@
+//go:build falcon_selfcheck
+
+package sampler
+
+// With the falcon_selfcheck build tag, the canary KAT runs when the package is
+// initialized, and a build with corrupted numerics refuses to start.
+func init() {
+	if err := canaryCheck(); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,129 @@
+package sampler
+
+import (
+	"fmt"
+	"math"
+)
+
+// SelfTestAlpha is the significance level of StatisticalSelfTest: a correct
+// sampler fails it with this probability.
+const SelfTestAlpha = 1e-6
+
+// selfTestMinExpected is the smallest expected count of a histogram bin for
+// the chi-squared approximation to hold; the tails are pooled until they
+// reach it.
+const selfTestMinExpected = 5
+
+// StatisticalSelfTest draws samples values of sampler.SamplerzChecked(mu,
+// sigma, sigmin) and runs a chi-squared goodness-of-fit test of their
+// histogram against DiscreteGaussianPMF(z, mu, sigma). It returns an error
+// wrapping ErrSelfTest if the p-value is below SelfTestAlpha, or the error
+// of sampling, e.g. wrapping ErrInvalidSigma for parameters out of range.
+//
+// The test detects departures of the order of sqrt(support / samples) in
+// statistical distance, so a few hundred thousand samples are needed to
+// catch subtle bugs, such as a rejection step off by a constant factor in
+// the exponent.
+func StatisticalSelfTest(sampler *Sampler, mu, sigma, sigmin float64, samples int) error {
+	if samples <= 0 {
+		return fmt.Errorf("sampler: self-test with %d samples", samples)
+	}
+	lo, hi := gaussianWindow(mu, sigma)
+	counts := make([]int, hi-lo+1)
+	for i := 0; i < samples; i++ {
+		z, err := sampler.SamplerzChecked(mu, sigma, sigmin)
+		if err != nil {
+			return err
+		}
+		// Samples outside of the window have a negligible probability, so
+		// landing in the outermost bins is as good as a failure.
+		counts[Clamp(z, lo, hi)-lo]++
+	}
+
+	norm := gaussianNorm(mu, sigma)
+	expected := make([]float64, len(counts))
+	for i := range expected {
+		expected[i] = float64(samples) * gaussianPMF(lo+i, mu, sigma, norm)
+	}
+	observed := make([]float64, len(counts))
+	for i, c := range counts {
+		observed[i] = float64(c)
+	}
+	observed, expected = poolTails(observed, expected, selfTestMinExpected)
+	if len(expected) < 2 {
+		return fmt.Errorf("sampler: self-test with %d samples leaves %d bins", samples, len(expected))
+	}
+
+	var chi2 float64
+	for i := range expected {
+		d := observed[i] - expected[i]
+		chi2 += d * d / expected[i]
+	}
+	df := len(expected) - 1
+	if p := chiSquaredSF(chi2, df); p < SelfTestAlpha {
+		return fmt.Errorf("%w: chi-squared %.2f with %d degrees of freedom, p-value %.3g", ErrSelfTest, chi2, df, p)
+	}
+	return nil
+}
+
+// poolTails merges the bins at both ends of a histogram into their
+// neighbours until their expected count is at least minExpected, and returns
+// the shortened histogram.
+func poolTails(observed, expected []float64, minExpected float64) ([]float64, []float64) {
+	for len(expected) > 1 && expected[0] < minExpected {
+		observed[1] += observed[0]
+		expected[1] += expected[0]
+		observed, expected = observed[1:], expected[1:]
+	}
+	for n := len(expected); n > 1 && expected[n-1] < minExpected; n-- {
+		observed[n-2] += observed[n-1]
+		expected[n-2] += expected[n-1]
+		observed, expected = observed[:n-1], expected[:n-1]
+	}
+	return observed, expected
+}
+
+// chiSquaredSF returns the probability that a chi-squared variable with df
+// degrees of freedom exceeds x, the regularized upper incomplete gamma
+// function Q(df / 2, x / 2).
+func chiSquaredSF(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	a, x := float64(df)/2, x/2
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(a*math.Log(x) - x - lg)
+	if x < a+1 {
+		// Series for P(a, x).
+		sum, term := 1/a, 1/a
+		for n := 1.0; n < 1000 && term > sum*0x1p-53; n++ {
+			term *= x / (a + n)
+			sum += term
+		}
+		return max(0, 1-prefix*sum)
+	}
+	// Continued fraction for Q(a, x), by the modified Lentz method.
+	const tiny = 0x1p-1000
+	b := x + 1 - a
+	c, d := 1/tiny, 1/b
+	h := d
+	for n := 1.0; n < 1000; n++ {
+		an := -n * (n - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 0x1p-53 {
+			break
+		}
+	}
+	return prefix * h
+}
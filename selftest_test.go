@@ -0,0 +1,59 @@
+package sampler
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestChiSquaredSF(t *testing.T) {
+	for _, tc := range []struct {
+		x    float64
+		df   int
+		want float64
+	}{
+		{0, 3, 1},
+		{3.841458820694124, 1, 0.05},
+		{18.307038053275146, 10, 0.05},
+		{2, 2, math.Exp(-1)},
+		// For even df, Q(k, x) = exp(-x) * sum(x^i / i!, i < k).
+		{10, 30, 0.9997737463238231},
+		{100, 20, 1.2596084591660908e-12},
+		{3, 6, 0.8088468305380581},
+	} {
+		if got := chiSquaredSF(tc.x, tc.df); math.Abs(got-tc.want) > 1e-9*tc.want {
+			t.Errorf("chiSquaredSF(%v, %d) = %v, want %v", tc.x, tc.df, got, tc.want)
+		}
+	}
+}
+
+func TestStatisticalSelfTest(t *testing.T) {
+	mu := -8.322564895434937
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	n := 200000
+
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	if err := StatisticalSelfTest(sp, mu, sigma, sigmin, n); err != nil {
+		t.Errorf("reference sampler: %v", err)
+	}
+
+	// A rejection step with the wrong exponent, or a truncated table.
+	sp = newsampler(fromSeedSHAKE(testSeed))
+	sp.inv2sigma2 *= 1.05
+	if err := StatisticalSelfTest(sp, mu, sigma, sigmin, n); !errors.Is(err, ErrSelfTest) {
+		t.Errorf("perturbed exponent: got %v, want ErrSelfTest", err)
+	}
+	sp = newsampler(fromSeedSHAKE(testSeed))
+	sp.rcdt = sp.rcdt[:3]
+	if err := StatisticalSelfTest(sp, mu, sigma, sigmin, n); !errors.Is(err, ErrSelfTest) {
+		t.Errorf("truncated table: got %v, want ErrSelfTest", err)
+	}
+
+	if err := StatisticalSelfTest(sp, mu, 2, sigmin, n); !errors.Is(err, ErrInvalidSigma) {
+		t.Errorf("sigma = 2: got %v, want ErrInvalidSigma", err)
+	}
+	if err := StatisticalSelfTest(sp, mu, sigma, sigmin, 0); err == nil {
+		t.Error("no error for 0 samples")
+	}
+}
@@ -0,0 +1,82 @@
+package sampler
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// stateMagic starts the serialized state of MarshalState, identifying its
+// format.
+const stateMagic = "FalconSampler/state\x01"
+
+// maxStateBuffer is the largest read buffer UnmarshalState restores, so that a
+// corrupted state cannot make it allocate up to 4 GiB.
+const maxStateBuffer = 1 << 20
+
+// MarshalState returns the position of sp in its randomness stream, from
+// which UnmarshalState resumes the identical continuation of the samples. It
+// captures the state of the SHAKE256 XOF and the bytes read ahead from it by
+// the read buffer, but not the options of sp.
+//
+// The source of sp must be a SHAKE256 stream, as for NewSamplerFromSeed and
+// Reseed; other sources give an error. MarshalState must not be called while
+// sp is sampling.
+func (sp *Sampler) MarshalState() ([]byte, error) {
+	src := sp.rng.Load()
+	m, ok := src.r.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil, errors.New("sampler: randomness source does not support state marshaling")
+	}
+	xof, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	pending := src.buf[src.off:src.end]
+	b := make([]byte, 0, len(stateMagic)+8+len(pending)+len(xof))
+	b = append(b, stateMagic...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(src.buf)))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(pending)))
+	b = append(b, pending...)
+	return append(b, xof...), nil
+}
+
+// UnmarshalState returns a sampler configured by opts resuming the stream of
+// the sampler whose state was returned by MarshalState: it draws the same
+// randomness, and so the same samples for the same options, as that sampler
+// would have from that point. The read buffer of the state is restored as it
+// was, whatever WithReadBuffer in opts.
+func UnmarshalState(state []byte, opts ...Option) (*Sampler, error) {
+	errInvalid := errors.New("sampler: invalid sampler state")
+	if len(state) < len(stateMagic)+8 || string(state[:len(stateMagic)]) != stateMagic {
+		return nil, errInvalid
+	}
+	b := state[len(stateMagic):]
+	size, n := binary.BigEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+	b = b[8:]
+	if size > maxStateBuffer || n > size || uint64(n) > uint64(len(b)) {
+		return nil, errInvalid
+	}
+	pending, xof := b[:n], b[n:]
+
+	shake := sha3.NewShake256()
+	u, ok := shake.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, errors.New("sampler: SHAKE256 does not support state marshaling on this platform")
+	}
+	if err := u.UnmarshalBinary(xof); err != nil {
+		return nil, err
+	}
+
+	sp, err := NewSamplerWithOptions(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sp.readBuffer = int(size)
+	src := sp.newSource(shake)
+	src.end = copy(src.buf, pending)
+	sp.rng.Store(src)
+	return sp, nil
+}
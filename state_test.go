@@ -0,0 +1,67 @@
+package sampler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestMarshalState(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sp   func() *Sampler
+	}{
+		{"buffered", func() *Sampler { return NewSamplerFromSeed(testSeed) }},
+		{"unbuffered", func() *Sampler { return newsampler(fromSeedSHAKE(testSeed)) }},
+		{"reseeded", func() *Sampler {
+			sp := NewSamplerFromBytes(nil)
+			sp.Reseed(testSeed)
+			return sp
+		}},
+	} {
+		sp, ref := tc.sp(), newsampler(fromSeedSHAKE(testSeed))
+		for _, skip := range []int{0, 1, 37, 500} {
+			for i := 0; i < skip; i++ {
+				if z, want := sp.Samplerz(0.5, 1.7, 1.28), ref.Samplerz(0.5, 1.7, 1.28); z != want {
+					t.Fatalf("%s: got %d, want %d", tc.name, z, want)
+				}
+			}
+			state, err := sp.MarshalState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sp, err = UnmarshalState(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		diffSamplers(t, sp, ref, 1000)
+	}
+}
+
+func TestMarshalStateInvalid(t *testing.T) {
+	if _, err := NewSamplerFromBytes(make([]byte, 100)).MarshalState(); err == nil {
+		t.Error("no error for a byte slice source")
+	}
+	if _, err := NewSamplerFromChaCha(make([]byte, 32)).MarshalState(); err == nil {
+		t.Error("no error for a ChaCha20 source")
+	}
+
+	state, err := NewSamplerFromSeed(testSeed).MarshalState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	huge := bytes.Clone(state)
+	binary.BigEndian.PutUint32(huge[len(stateMagic):], maxStateBuffer+1)
+	for _, bad := range [][]byte{
+		nil,
+		state[:10],
+		state[:len(state)-1],
+		append([]byte("x"), state[1:]...),
+		huge,
+	} {
+		if _, err := UnmarshalState(bad); err == nil {
+			t.Errorf("no error for a state of %d bytes", len(bad))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package sampler
+
+import "math"
+
+// pmfTail is the half-width of the window, in standard deviations, over which
+// the discrete Gaussian is normalized. The mass outside of it is below 2^-100.
+const pmfTail = 12
+
+// gaussianWindow returns the integer range [lo, hi] holding all but a
+// negligible part of the mass of D_{Z, mu, sigma}.
+func gaussianWindow(mu, sigma float64) (lo, hi int) {
+	w := math.Ceil(pmfTail * sigma)
+	return int(math.Floor(mu) - w), int(math.Ceil(mu) + w)
+}
+
+// gaussianNorm returns the normalization constant sum(exp(-(z - mu)^2 / (2 * sigma^2)))
+// of D_{Z, mu, sigma}, summed over gaussianWindow.
+func gaussianNorm(mu, sigma float64) float64 {
+	lo, hi := gaussianWindow(mu, sigma)
+	dss := 1 / (2 * sigma * sigma)
+	var norm float64
+	for z := lo; z <= hi; z++ {
+		norm += math.Exp(-math.Pow(float64(z)-mu, 2) * dss)
+	}
+	return norm
+}
+
+// gaussianPMF returns the probability of z under D_{Z, mu, sigma}, given the
+// normalization constant from gaussianNorm.
+func gaussianPMF(z int, mu, sigma, norm float64) float64 {
+	return math.Exp(-math.Pow(float64(z)-mu, 2)/(2*sigma*sigma)) / norm
+}
+
+// DiscreteGaussianPMF returns the probability of z under the discrete
+// Gaussian D_{Z, mu, sigma} targeted by Samplerz, exp(-(z - mu)^2 / (2 *
+// sigma^2)) normalized over all but a negligible part of its mass, e.g. to
+// test a histogram of samples for goodness of fit. sigma must be positive.
+//
+// It sums the normalization anew on each call, over about 24 * sigma terms;
+// to tabulate many values of z, compute them once per center.
+func DiscreteGaussianPMF(z int, mu, sigma float64) float64 {
+	return gaussianPMF(z, mu, sigma, gaussianNorm(mu, sigma))
+}
+
+// StatisticalDistance estimates the statistical (total variation) distance
+// between the output of sp and the ideal discrete Gaussian D_{Z, mu, sigma}.
+//
+// It draws n samples and returns 1/2 * sum(|P_emp(z) - P(z)|) over every z
+// that is either in the support window or was observed. The estimate is
+// biased upwards by sampling noise of order sqrt(support / n), so n should be
+// large relative to the precision sought.
+func StatisticalDistance(sp *Sampler, mu, sigma, sigmin float64, n int) float64 {
+	lo, hi := gaussianWindow(mu, sigma)
+	counts := make([]int, hi-lo+1)
+	var outside int // samples that landed outside of the window
+	for i := 0; i < n; i++ {
+		z := sp.Samplerz(mu, sigma, sigmin)
+		if z < lo || z > hi {
+			outside++
+			continue
+		}
+		counts[z-lo]++
+	}
+
+	norm := gaussianNorm(mu, sigma)
+	dist := float64(outside) / float64(n)
+	for i, c := range counts {
+		dist += math.Abs(float64(c)/float64(n) - gaussianPMF(lo+i, mu, sigma, norm))
+	}
+	return dist / 2
+}
+
+// Histogram counts samples by value.
+type Histogram map[int]int
+
+// CollectHistogram draws n samples of Samplerz(mu, sigma, sigmin) from sp and
+// returns their histogram. It panics as Samplerz.
+func CollectHistogram(sp *Sampler, mu, sigma, sigmin float64, n int) Histogram {
+	h := make(Histogram)
+	for i := 0; i < n; i++ {
+		h[sp.Samplerz(mu, sigma, sigmin)]++
+	}
+	return h
+}
+
+// Count returns the number of samples in h.
+func (h Histogram) Count() int {
+	var n int
+	for _, c := range h {
+		n += c
+	}
+	return n
+}
+
+// MeanVariance returns the empirical mean of the samples in h and their
+// unbiased empirical variance, to compare with mu and sigma^2. The variance
+// is NaN for fewer than 2 samples, and both are for none.
+func (h Histogram) MeanVariance() (mean, variance float64) {
+	n := float64(h.Count())
+	for z, c := range h {
+		mean += float64(z) * float64(c)
+	}
+	mean /= n
+	for z, c := range h {
+		d := float64(z) - mean
+		variance += d * d * float64(c)
+	}
+	return mean, variance / (n - 1)
+}
+
+// SamplerzWithProb returns a sample of D_{Z, mu, sigma} together with its log
+// probability under that distribution, as needed by importance-sampling
+// estimators. The probability is computed analytically from z, mu and sigma,
+// not from the rejection loop; the sample itself is the one Samplerz would
+// have returned.
+//
+// The log probability is that of the ideal distribution. It does not account
+// for the approximations of sp: the table and precision of the base sampler
+// (WithTable, WithRCDTPrecisionBytes), the fixed-point ApproxExp and its
+// scale (WithApproxExpScale), or the rounding of WithExpCache, which all make
+// the distribution actually sampled differ slightly from D_{Z, mu, sigma}.
+func (sp *Sampler) SamplerzWithProb(mu, sigma, sigmin float64) (z int, logProb float64) {
+	z = sp.Samplerz(mu, sigma, sigmin)
+	logProb = -math.Pow(float64(z)-mu, 2)/(2*sigma*sigma) - math.Log(gaussianNorm(mu, sigma))
+	return z, logProb
+}
+
+// halfGaussianNorm returns sum(exp(-k^2 * inv2sigma2)) over k >= 0, the
+// normalization of the distribution of the base sampler.
+func halfGaussianNorm(inv2sigma2 float64) float64 {
+	var norm float64
+	for k := 0; ; k++ {
+		rho := math.Exp(-float64(k*k) * inv2sigma2)
+		if rho < 0x1p-64 {
+			return norm
+		}
+		norm += rho
+	}
+}
+
+// ExpectedIterations returns the expected number of iterations of the
+// rejection loop of Samplerz for the given sigma and sigmin, which bounds the
+// randomness and time a sample needs.
+//
+// An iteration proposes z with probability rho_maxsigma(z0) / (2 * halfNorm),
+// and accepts it with probability ccs * rho_sigma(z - r) / rho_maxsigma(z0),
+// so it succeeds with probability ccs * sum(rho_sigma(z - r)) / (2 * halfNorm).
+// For sigma > 1 the sum is sigma * sqrt(2 * pi) up to a relative 2^-40,
+// whatever the center.
+func ExpectedIterations(sigma, sigmin float64) float64 {
+	return expectedIterations(sigma, sigmin, halfGaussianNorm(inv2sigma2))
+}
+
+func expectedIterations(sigma, sigmin, halfNorm float64) float64 {
+	ccs := sigmin / sigma
+	return 2 * halfNorm / (ccs * sigma * math.Sqrt(2*math.Pi))
+}
+
+// gaussianEntropy returns the Shannon entropy, in bits, of D_{Z, mu, sigma}.
+func gaussianEntropy(mu, sigma float64) float64 {
+	lo, hi := gaussianWindow(mu, sigma)
+	norm := gaussianNorm(mu, sigma)
+	var h float64
+	for z := lo; z <= hi; z++ {
+		if p := gaussianPMF(z, mu, sigma, norm); p > 0 {
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// RandomnessAmplification returns the ratio of the entropy of a sample of
+// Samplerz(0, sigma, sigmin), in bits, to the expected number of random bits
+// consumed to produce it. It is well below 1: most of the randomness goes to
+// the 72-bit base sampler draws and to rejected trials.
+//
+// A trial consumes RCDTprecLen bytes for the base sampler, 1 sign byte and in
+// berexp 1 byte, plus one more each time a byte matches the threshold, which
+// is taken to happen with probability 1/256. The entropy barely depends on
+// the center for sigma > 1.
+func RandomnessAmplification(sigma, sigmin float64) float64 {
+	var berexpBytes float64
+	for k := 0; k < 8; k++ {
+		berexpBytes += math.Pow(256, -float64(k))
+	}
+	trialBits := 8 * (float64(RCDTprecLen) + 1 + berexpBytes)
+	return gaussianEntropy(0, sigma) / (ExpectedIterations(sigma, sigmin) * trialBits)
+}
+
+// SamplerzWithStats returns Samplerz(mu, sigma, sigmin) together with the
+// number of trials of the rejection loop, each a base sample and a BerExp,
+// that it took; the sample is the one Samplerz would have returned. It panics
+// as Samplerz.
+func (sp *Sampler) SamplerzWithStats(mu, sigma, sigmin float64) (z int, iterations int) {
+	z, iterations, err := sp.samplerz(mu, sigma, sigmin)
+	if err != nil {
+		panic(err)
+	}
+	return z, iterations
+}
@@ -0,0 +1,190 @@
+package sampler
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStatisticalDistance(t *testing.T) {
+	mu := -8.322564895434937
+	sigma := 1.7037990414754918
+	sigmin := 1.2778336969128337
+	n := 200000
+
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	if d := StatisticalDistance(sp, mu, sigma, sigmin, n); d > 0.01 {
+		t.Errorf("distance of the reference table: got %f, want <= 0.01", d)
+	}
+
+	// Truncating the table caps the base sampler at 2, which cuts off the
+	// tails of the distribution.
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithTable(RCDT[:2], 1.8205, RCDTprec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := StatisticalDistance(sp, mu, sigma, sigmin, n); d < 0.05 {
+		t.Errorf("distance of a truncated table: got %f, want >= 0.05", d)
+	}
+}
+
+func TestDiscreteGaussianPMF(t *testing.T) {
+	for _, tc := range []struct{ mu, sigma float64 }{
+		{0, 1.7}, {-8.322564895434937, 1.7037990414754918}, {0.5, 1.28}, {1e4 + 0.25, 40},
+	} {
+		var total, mean float64
+		for z := int(tc.mu) - 30*int(tc.sigma+1); z <= int(tc.mu)+30*int(tc.sigma+1); z++ {
+			p := DiscreteGaussianPMF(z, tc.mu, tc.sigma)
+			total += p
+			mean += p * float64(z)
+		}
+		if math.Abs(total-1) > 1e-12 {
+			t.Errorf("mu = %v, sigma = %v: mass %v, want 1", tc.mu, tc.sigma, total)
+		}
+		if math.Abs(mean-tc.mu) > 1e-9*math.Max(1, math.Abs(tc.mu)) {
+			t.Errorf("mu = %v, sigma = %v: mean %v", tc.mu, tc.sigma, mean)
+		}
+	}
+	// Symmetric about a half-integer center, and proportional to rho_sigma.
+	if p, q := DiscreteGaussianPMF(-3, 0.5, 1.7), DiscreteGaussianPMF(4, 0.5, 1.7); p != q {
+		t.Errorf("P(-3) = %v, P(4) = %v about 0.5", p, q)
+	}
+	if r, want := DiscreteGaussianPMF(2, 0, 1.7)/DiscreteGaussianPMF(0, 0, 1.7), math.Exp(-4/(2*1.7*1.7)); math.Abs(r-want) > 1e-15 {
+		t.Errorf("P(2) / P(0) = %v, want %v", r, want)
+	}
+}
+
+func TestSamplerzWithProb(t *testing.T) {
+	mu := 7.9386734193997555
+	sigma := 1.6984647769450156
+	sigmin := 1.2778336969128337
+
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	norm := gaussianNorm(mu, sigma)
+	seen := make(map[int]float64)
+	for i := 0; i < 100000; i++ {
+		z, logProb := sp.SamplerzWithProb(mu, sigma, sigmin)
+		if want := ref.Samplerz(mu, sigma, sigmin); z != want {
+			t.Fatalf("sample %d: got %d, Samplerz gives %d", i, z, want)
+		}
+		if want := math.Log(gaussianPMF(z, mu, sigma, norm)); math.Abs(logProb-want) > 1e-12 {
+			t.Fatalf("log probability of %d: got %v, want %v", z, logProb, want)
+		}
+		seen[z] = logProb
+	}
+
+	// Every value with non-negligible mass shows up, so the probabilities of
+	// the observed values add up to almost 1.
+	var total float64
+	for _, logProb := range seen {
+		total += math.Exp(logProb)
+	}
+	if total < 1-1e-4 || total > 1+1e-12 {
+		t.Fatalf("probabilities of observed values sum to %v", total)
+	}
+}
+
+func TestRandomnessAmplification(t *testing.T) {
+	for _, p := range []struct{ sigma, sigmin float64 }{
+		{1.7037990414754918, 1.2778336969128337},
+		{1.2778336969128337 + 1e-9, 1.2778336969128337},
+		{1.8, 1.298280334344292},
+	} {
+		// The entropy of the continuous Gaussian, log2(sigma * sqrt(2 pi e)),
+		// is very close for sigma > 1.
+		if h, want := gaussianEntropy(0.3, p.sigma), math.Log2(p.sigma*math.Sqrt(2*math.Pi*math.E)); math.Abs(h-want) > 1e-3 {
+			t.Errorf("sigma %v: entropy %f, want about %f", p.sigma, h, want)
+		}
+		// A couple of bits out of one or two trials of about 88 bits.
+		if a := RandomnessAmplification(p.sigma, p.sigmin); !(a > 0.005 && a < 0.05) {
+			t.Errorf("sigma %v, sigmin %v: amplification %f out of (0.005, 0.05)", p.sigma, p.sigmin, a)
+		}
+	}
+}
+
+func TestExpectedIterations(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	for _, p := range []struct{ sigma, sigmin float64 }{
+		{1.7037990414754918, 1.2778336969128337},
+		{1.3052985443865464, 1.298280334344292},
+		{1.8192822961910, 1.2778336969128337},
+		{1.5, 1.1},
+	} {
+		want := ExpectedIterations(p.sigma, p.sigmin)
+		// The iterations are geometric with success probability 1 / want.
+		const n = 100000
+		var total int
+		for i := 0; i < n; i++ {
+			_, iter := sp.SamplerzWithStats(float64(i)/n*10-5, p.sigma, p.sigmin)
+			total += iter
+		}
+		mean := float64(total) / n
+		if sd := math.Sqrt((want - 1) * want / n); math.Abs(mean-want) > 4*sd {
+			t.Errorf("sigma %v, sigmin %v: %v iterations on average, want %v", p.sigma, p.sigmin, mean, want)
+		}
+	}
+}
+
+func TestSamplerzWithStats(t *testing.T) {
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 2000; i++ {
+		mu := float64(i)/7 - 140
+		rr := &recordingReader{r: fromSeedSHAKE([]byte{byte(i), byte(i >> 8)})}
+		counted := newsampler(rr)
+
+		z, iter := sp.SamplerzWithStats(mu, 1.7, 1.28)
+		if want := ref.Samplerz(mu, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+		if iter < 1 {
+			t.Fatalf("sample %d: %d iterations", i, iter)
+		}
+		// Each trial reads a base sample, a sign byte and 1 to 8 bytes.
+		_, iter = counted.SamplerzWithStats(mu, 1.7, 1.28)
+		if n := len(rr.seen); n < iter*(int(RCDTprecLen)+2) || n > iter*(int(RCDTprecLen)+9) {
+			t.Fatalf("sample %d: %d bytes read in %d iterations", i, n, iter)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	const mu, sigma, sigmin = -3.4, 1.8, 1.28
+	const n = 100000
+	h := CollectHistogram(newsampler(fromSeedSHAKE(testSeed)), mu, sigma, sigmin, n)
+	if got := h.Count(); got != n {
+		t.Fatalf("%d samples in the histogram, want %d", got, n)
+	}
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	want := make(Histogram)
+	for i := 0; i < n; i++ {
+		want[ref.Samplerz(mu, sigma, sigmin)]++
+	}
+	for z, c := range want {
+		if h[z] != c {
+			t.Fatalf("count of %d is %d, want %d", z, h[z], c)
+		}
+	}
+
+	// The moments of D_{Z, mu, sigma}, within 4 standard errors.
+	var wantMean, wantVar float64
+	for z := -40; z <= 40; z++ {
+		p := DiscreteGaussianPMF(z, mu, sigma)
+		wantMean += p * float64(z)
+		wantVar += p * (float64(z) - mu) * (float64(z) - mu)
+	}
+	mean, variance := h.MeanVariance()
+	if math.Abs(mean-wantMean) > 4*math.Sqrt(wantVar/n) {
+		t.Errorf("mean %v, want %v", mean, wantMean)
+	}
+	if math.Abs(variance-wantVar) > 4*wantVar*math.Sqrt(2.0/n) {
+		t.Errorf("variance %v, want %v", variance, wantVar)
+	}
+	if s := math.Sqrt(variance); math.Abs(s-sigma) > 0.01*sigma {
+		t.Errorf("empirical sigma %v, want %v", s, sigma)
+	}
+
+	if mean, variance := (Histogram{3: 1}).MeanVariance(); mean != 3 || !math.IsNaN(variance) {
+		t.Errorf("one sample: mean %v, variance %v", mean, variance)
+	}
+}
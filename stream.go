@@ -0,0 +1,31 @@
+package sampler
+
+import "context"
+
+// Stream returns a channel of the successive samples of Samplerz(mu, sigma,
+// sigmin), produced by a goroutine of its own until ctx is done. The channel
+// is unbuffered, so no sample is drawn ahead of its consumer.
+//
+// Once ctx is done, the goroutine stops before drawing the next sample, or
+// while waiting to send one, and closes the channel; it also stops and closes
+// it when sampling fails, e.g. on an error of the randomness source or
+// invalid parameters. sp belongs to the goroutine until the channel is
+// closed, and must not be used otherwise meanwhile.
+func (sp *Sampler) Stream(ctx context.Context, mu, sigma, sigmin float64) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for ctx.Err() == nil {
+			z, err := sp.SamplerzErr(mu, sigma, sigmin)
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- z:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,57 @@
+package sampler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	ch := sp.Stream(ctx, 3.3, 1.7, 1.28)
+	for i := 0; i < 1000; i++ {
+		if z, want := <-ch, ref.Samplerz(3.3, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+	}
+	cancel()
+	// At most one sample was in flight when the context was cancelled.
+	n := 0
+	for range ch {
+		n++
+	}
+	if n > 1 {
+		t.Errorf("%d samples after cancellation", n)
+	}
+}
+
+func TestStreamStops(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		sp   *Sampler
+	}{
+		{"error", NewSamplerFromBytes(make([]byte, 30))},
+		{"cancelled", newsampler(fromSeedSHAKE(testSeed))},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.name == "cancelled" {
+			cancel()
+		}
+		ch := tc.sp.Stream(ctx, 0, 1.7, 1.28)
+		timeout := time.After(5 * time.Second)
+	drain:
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				t.Fatalf("%s: channel not closed", tc.name)
+			}
+		}
+		cancel()
+	}
+}
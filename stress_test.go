@@ -0,0 +1,43 @@
+//go:build long
+
+package sampler
+
+import (
+	"runtime"
+	"testing"
+)
+
+// TestMemoryStability draws 1e8 samples, which takes about a minute, so it
+// only runs with the long build tag: go test -tags long -run MemoryStability.
+func TestMemoryStability(t *testing.T) {
+	const (
+		checkpoints = 100
+		perCheck    = 1000000
+		// Slack for allocations done by the runtime and the testing package.
+		heapSlack   = 1 << 20
+		mallocSlack = 1000
+	)
+	mu := 217.87844009133536
+	sigma := 1.3052985443865464
+	sigmin := 1.298280334344292
+	sp := newsampler(fromSeedSHAKE(testSeed))
+
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	baseHeap := ms.HeapAlloc
+	for i := 0; i < checkpoints; i++ {
+		mallocs := ms.Mallocs
+		for j := 0; j < perCheck; j++ {
+			sp.Samplerz(mu, sigma, sigmin)
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		if ms.HeapAlloc > baseHeap+heapSlack {
+			t.Fatalf("after %d samples: heap grew from %d to %d bytes", (i+1)*perCheck, baseHeap, ms.HeapAlloc)
+		}
+		if d := ms.Mallocs - mallocs; d > mallocSlack {
+			t.Fatalf("after %d samples: %d allocations over the last %d samples", (i+1)*perCheck, d, perCheck)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package sampler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/holiman/uint256"
+)
+
+// GenerateRCDT computes the reverse cumulative distribution table of the
+// half-Gaussian of parameter sigma over {0, 1, ...} at the given bit
+// precision, in the format of RCDT. The result can be used with
+// NewSamplerWithTable.
+//
+// As for the reference table, each probability P(k) = rho(k) / sum(rho) is
+// first truncated to precision bits, and entry i is the sum of the truncated
+// P(k) for k > i. The table stops before the first zero entry.
+//
+// sigma is interpreted as the shortest decimal that rounds to it, so that
+// GenerateRCDT(1.8205, 72) computes with 1.8205 exactly and reproduces RCDT.
+// The arithmetic is carried out with math/big, well above precision bits.
+func GenerateRCDT(sigma float64, precision uint8) ([]*uint256.Int, error) {
+	if err := validateSigma(sigma); err != nil {
+		return nil, err
+	}
+	if precision == 0 {
+		return nil, errors.New("sampler: table precision must be positive")
+	}
+	exact, ok := new(big.Rat).SetString(strconv.FormatFloat(sigma, 'g', -1, 64))
+	if !ok {
+		return nil, errors.New("sampler: cannot represent sigma exactly")
+	}
+
+	prec := uint(precision) + 128
+	// dss = 1 / (2 * sigma^2)
+	dss := new(big.Rat).Mul(exact, exact)
+	dss.Mul(dss, big.NewRat(2, 1))
+	dss.Inv(dss)
+
+	// rho(k) = exp(-k^2 * dss), until it no longer weighs on the normalization.
+	negligible := new(big.Float).SetMantExp(big.NewFloat(1), -int(prec))
+	var rho []*big.Float
+	norm := new(big.Float).SetPrec(prec)
+	for k := int64(0); ; k++ {
+		t := new(big.Rat).Mul(dss, big.NewRat(k*k, 1))
+		r := expNeg(new(big.Float).SetPrec(prec).SetRat(t), prec)
+		if r.Cmp(negligible) < 0 {
+			break
+		}
+		rho = append(rho, r)
+		norm.Add(norm, r)
+	}
+
+	// P(k) truncated to precision bits.
+	scale := new(big.Float).SetPrec(prec).SetMantExp(big.NewFloat(1), int(precision))
+	probs := make([]*big.Int, len(rho))
+	for k, r := range rho {
+		p := new(big.Float).SetPrec(prec).Quo(r, norm)
+		probs[k], _ = p.Mul(p, scale).Int(nil)
+	}
+
+	var table []*uint256.Int
+	acc := new(big.Int)
+	for _, p := range probs {
+		acc.Add(acc, p)
+	}
+	for _, p := range probs {
+		acc.Sub(acc, p)
+		if acc.Sign() == 0 {
+			break
+		}
+		elt, overflow := uint256.FromBig(acc)
+		if overflow {
+			return nil, errors.New("sampler: table entry overflows 256 bits")
+		}
+		table = append(table, elt)
+	}
+	return table, nil
+}
+
+// validateSigma returns an error wrapping ErrInvalidSigma unless sigma is
+// positive and finite.
+func validateSigma(sigma float64) error {
+	if !(sigma > 0) || math.IsInf(sigma, 0) {
+		return fmt.Errorf("%w: sigma = %v is not positive and finite", ErrInvalidSigma, sigma)
+	}
+	return nil
+}
+
+// expNeg returns exp(-t) for t >= 0, computed at prec bits.
+func expNeg(t *big.Float, prec uint) *big.Float {
+	// exp(t) = exp(t / 2^m)^(2^m), with t / 2^m < 1/2 for a fast series.
+	m := max(t.MantExp(nil)+1, 0)
+	prec += uint(m)
+	u := new(big.Float).SetPrec(prec).SetMantExp(t, -m)
+
+	sum := new(big.Float).SetPrec(prec).SetInt64(1)
+	term := new(big.Float).SetPrec(prec).SetInt64(1)
+	eps := new(big.Float).SetMantExp(big.NewFloat(1), -int(prec))
+	for n := int64(1); term.Cmp(eps) > 0; n++ {
+		term.Mul(term, u)
+		term.Quo(term, new(big.Float).SetInt64(n))
+		sum.Add(sum, term)
+	}
+	for i := 0; i < m; i++ {
+		sum.Mul(sum, sum)
+	}
+	return sum.Quo(new(big.Float).SetPrec(prec).SetInt64(1), sum)
+}
+
+// WithTable makes the base sampler use table, the reverse cumulative
+// distribution table of a half-Gaussian of parameter sigma at the given bit
+// precision, instead of RCDT. Each base sampler draw then reads precision / 8
+// bytes. The table can be produced by GenerateRCDT; it must be non-empty,
+// strictly decreasing and fit in precision bits, which must be a multiple of
+// 8. Samplerz must then be called with sigma below the one of the table.
+// With WithFixedPointExponent, the table must have at most 29 entries.
+func WithTable(table []*uint256.Int, sigma float64, precision uint8) Option {
+	return func(sp *Sampler) error {
+		if err := validateSigma(sigma); err != nil {
+			return err
+		}
+		if precision == 0 || precision%8 != 0 {
+			return errors.New("sampler: table precision must be a positive multiple of 8")
+		}
+		if len(table) == 0 {
+			return errors.New("sampler: empty table")
+		}
+		if err := sp.checkFixedPointTable(len(table)); err != nil {
+			return err
+		}
+		rcdt := make([]*uint256.Int, len(table))
+		for i, elt := range table {
+			if elt.BitLen() > int(precision) {
+				return errors.New("sampler: table entry exceeds the table precision")
+			}
+			if i > 0 && !elt.Lt(table[i-1]) {
+				return errors.New("sampler: table is not strictly decreasing")
+			}
+			rcdt[i] = elt.Clone()
+		}
+		sp.rcdt = rcdt
+		sp.inv2sigma2 = 1 / (2 * sigma * sigma)
+		sp.maxSigma = sigma
+		sp.halfNorm = halfGaussianNorm(sp.inv2sigma2)
+		sp.setReadBuffers(int(precision >> 3))
+		return nil
+	}
+}
+
+// WithRCDTPrecisionBytes makes the base sampler draw n bytes per sample
+// instead of RCDTprecLen, with the table of the same sigma regenerated at 8n
+// bits by GenerateRCDT; the default, and GenerateRCDT(MAX_SIGMA, 72), is RCDT.
+// It is meant for variants of Falcon with another table precision. n must be
+// between 1 and 31.
+func WithRCDTPrecisionBytes(n int) Option {
+	return func(sp *Sampler) error {
+		if n < 1 || n > 31 {
+			return errors.New("sampler: table precision must be between 1 and 31 bytes")
+		}
+		table, err := GenerateRCDT(sp.maxSigma, uint8(8*n))
+		if err != nil {
+			return err
+		}
+		return WithTable(table, sp.maxSigma, uint8(8*n))(sp)
+	}
+}
+
+// NewSamplerWithTable returns a sampler reading its randomness from rng whose
+// base sampler uses table, see WithTable.
+func NewSamplerWithTable(rng io.Reader, table []*uint256.Int, sigma float64, precision uint8) (*Sampler, error) {
+	return NewSamplerWithOptions(rng, WithTable(table, sigma, precision))
+}
+
+// RCDTTable returns a copy of RCDT, the reverse cumulative distribution table
+// of the base sampler, which can be inspected or modified without affecting
+// any sampler.
+func RCDTTable() []*uint256.Int {
+	return cloneTable(RCDT)
+}
+
+// CoeffTable returns a copy of C, the coefficients of the polynomial of
+// approxexp, which can be inspected or modified without affecting any sampler.
+func CoeffTable() []*uint256.Int {
+	return cloneTable(C)
+}
+
+func cloneTable(table []*uint256.Int) []*uint256.Int {
+	c := make([]*uint256.Int, len(table))
+	for i, elt := range table {
+		c[i] = elt.Clone()
+	}
+	return c
+}
+
+// RCDTEqual reports whether the tables a and b have the same entries.
+func RCDTEqual(a, b []*uint256.Int) bool {
+	return RCDTClose(a, b, 0)
+}
+
+// RCDTClose reports whether the tables a and b have the same length and
+// entries differing by at most ulps units in the last place, which allows for
+// the rounding of independently generated tables.
+func RCDTClose(a, b []*uint256.Int, ulps uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	var d uint256.Int
+	for i := range a {
+		if a[i].Lt(b[i]) {
+			d.Sub(b[i], a[i])
+		} else {
+			d.Sub(a[i], b[i])
+		}
+		if d.GtUint64(ulps) {
+			return false
+		}
+	}
+	return true
+}
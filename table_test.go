@@ -0,0 +1,201 @@
+package sampler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+// rcdtSpec is the RCDT table of the Falcon specification, in decimal.
+var rcdtSpec = []string{
+	"3024686241123004913666",
+	"1564742784480091954050",
+	"636254429462080897535",
+	"199560484645026482916",
+	"47667343854657281903",
+	"8595902006365044063",
+	"1163297957344668388",
+	"117656387352093658",
+	"8867391802663976",
+	"496969357462633",
+	"20680885154299",
+	"638331848991",
+	"14602316184",
+	"247426747",
+	"3104126",
+	"28824",
+	"198",
+	"1",
+}
+
+// specRCDT returns rcdtSpec as a table.
+func specRCDT(t *testing.T) []*uint256.Int {
+	table := make([]*uint256.Int, len(rcdtSpec))
+	for i, s := range rcdtSpec {
+		var err error
+		if table[i], err = uint256.FromDecimal(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return table
+}
+
+func TestGenerateRCDT(t *testing.T) {
+	table, err := GenerateRCDT(1.8205, RCDTprec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := specRCDT(t)
+	if len(table) != len(want) {
+		t.Fatalf("generated %d entries, want %d", len(table), len(want))
+	}
+	for i := range table {
+		if !table[i].Eq(want[i]) {
+			t.Errorf("entry %d: generated %s, want %s", i, table[i].Hex(), want[i].Hex())
+		}
+	}
+}
+
+func TestGenerateRCDTInvalid(t *testing.T) {
+	for _, sigma := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		if _, err := GenerateRCDT(sigma, 72); err == nil {
+			t.Errorf("sigma %v: expected an error", sigma)
+		}
+	}
+	if _, err := GenerateRCDT(1.8205, 0); err == nil {
+		t.Error("precision 0: expected an error")
+	}
+}
+
+func TestNewSamplerWithTable(t *testing.T) {
+	// The table of the specification through WithTable behaves as the
+	// default sampler.
+	sp, err := NewSamplerWithTable(fromSeedSHAKE(testSeed), specRCDT(t), 1.8205, RCDTprec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		if z, want := sp.Samplerz(0.25, 1.7, 1.28), ref.Samplerz(0.25, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+	}
+
+	// A wider table at another precision allows a larger sigma.
+	table, err := GenerateRCDT(3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp, err = NewSamplerWithTable(fromSeedSHAKE(testSeed), table, 3, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := StatisticalDistance(sp, 4.4, 2.8, 1.28, 200000); d > 0.01 {
+		t.Errorf("distance with a generated table: got %f, want <= 0.01", d)
+	}
+}
+
+func TestNewSamplerWithTableInvalid(t *testing.T) {
+	reversed := []*uint256.Int{RCDT[1], RCDT[0]}
+	for _, tc := range []struct {
+		name      string
+		table     []*uint256.Int
+		sigma     float64
+		precision uint8
+	}{
+		{"empty", nil, 1.8205, 72},
+		{"precision not in bytes", RCDT, 1.8205, 70},
+		{"entry above precision", RCDT, 1.8205, 64},
+		{"not decreasing", reversed, 1.8205, 72},
+		{"bad sigma", RCDT, 0, 72},
+	} {
+		if _, err := NewSamplerWithTable(nil, tc.table, tc.sigma, tc.precision); err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+	}
+}
+
+func TestRCDTEqual(t *testing.T) {
+	if !RCDTEqual(RCDT, RCDT) {
+		t.Error("RCDT differs from itself")
+	}
+	if RCDTEqual(RCDT, RCDT[:len(RCDT)-1]) {
+		t.Error("tables of different lengths are equal")
+	}
+	table, err := GenerateRCDT(1.8205, RCDTprec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !RCDTClose(table, specRCDT(t), 1) {
+		t.Error("generated table is not close to the specification")
+	}
+
+	perturbed := make([]*uint256.Int, len(RCDT))
+	copy(perturbed, RCDT)
+	perturbed[3] = new(uint256.Int).AddUint64(RCDT[3], 2)
+	perturbed[7] = new(uint256.Int).SubUint64(RCDT[7], 2)
+	if RCDTEqual(perturbed, RCDT) || RCDTClose(perturbed, RCDT, 1) || RCDTClose(RCDT, perturbed, 1) {
+		t.Error("tables 2 ulps apart are close within 1 ulp")
+	}
+	if !RCDTClose(perturbed, RCDT, 2) || !RCDTClose(RCDT, perturbed, 2) {
+		t.Error("tables 2 ulps apart are not close within 2 ulps")
+	}
+}
+
+func TestWithRCDTPrecisionBytes(t *testing.T) {
+	// The default precision reproduces the reference sampler.
+	sp, err := NewSamplerWithOptions(fromSeedSHAKE(testSeed), WithRCDTPrecisionBytes(int(RCDTprecLen)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffSamplers(t, sp, newsampler(fromSeedSHAKE(testSeed)), 1000)
+
+	// At 96 bits, each trial reads 12 bytes for the base sampler, and the
+	// output is still the discrete Gaussian.
+	c := NewCountingReader(fromSeedSHAKE(testSeed))
+	sp, err = NewSamplerWithOptions(c, WithRCDTPrecisionBytes(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.baseSamplerRB) != 12 || sp.MaxBaseSample() < len(RCDT) {
+		t.Fatalf("got %d-byte draws and %d entries", len(sp.baseSamplerRB), sp.MaxBaseSample())
+	}
+	_, iterations, err := sp.samplerz(0.5, 1.7, 1.28)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.BytesRead(); n < uint64(14*iterations) || n > uint64(21*iterations) {
+		t.Errorf("read %d bytes in %d trials", n, iterations)
+	}
+	if err := StatisticalSelfTest(sp, -8.322564895434937, 1.7037990414754918, 1.2778336969128337, 100000); err != nil {
+		t.Error(err)
+	}
+
+	for _, n := range []int{-1, 0, 32} {
+		if _, err := NewSamplerWithOptions(nil, WithRCDTPrecisionBytes(n)); err == nil {
+			t.Errorf("n = %d: expected an error", n)
+		}
+	}
+}
+
+func TestTableAccessors(t *testing.T) {
+	rcdt, c := RCDTTable(), CoeffTable()
+	if !RCDTEqual(rcdt, RCDT) || !RCDTEqual(c, C) {
+		t.Fatal("accessors differ from the tables")
+	}
+	// Modify the entries of the copies in place, and the copies themselves.
+	for _, table := range [][]*uint256.Int{rcdt, c} {
+		for _, elt := range table {
+			elt.SetAllOne()
+		}
+		table[0] = uint256.NewInt(1)
+	}
+	sp := newsampler(nil)
+	for _, v := range samplerKATs()[:64] {
+		sp.SetReader(bytesReader(decodeHexString(v.Octets)))
+		if z := sp.Samplerz(v.Mu, v.Sigma, v.Sigmin); z != v.Z {
+			t.Fatalf("got %d, want %d after modifying the copies", z, v.Z)
+		}
+	}
+}
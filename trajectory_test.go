@@ -0,0 +1,112 @@
+package sampler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// recordingReader remembers every byte read through it until reset.
+type recordingReader struct {
+	r    io.Reader
+	seen []byte
+}
+
+func (rr *recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	rr.seen = append(rr.seen, p[:n]...)
+	return n, err
+}
+
+// DumpTrajectory writes, for each of n samples drawn from a SHAKE256 stream
+// seeded with seed, every rejection trial: the random bytes it consumed, z0,
+// the sign bit b, x, the BerExp threshold 2 · ApproxExp − 1 scaled down by
+// 2^s and the BerExp decision. It walks the primitives in the same order as
+// Samplerz, so diffing the dump against the one of a reference implementation
+// points at the first diverging primitive.
+//
+// It stops at the first failure of the randomness source, and returns it.
+func DumpTrajectory(seed []byte, mu, sigma, sigmin float64, n int, w io.Writer) error {
+	rr := &recordingReader{r: fromSeedSHAKE(seed)}
+	sp := newsampler(rr)
+
+	s := int(math.Floor(mu))
+	r := mu - float64(s)
+	dss := 1 / (2 * sigma * sigma)
+	ccs := sigmin / sigma
+	for i := 0; i < n; i++ {
+		for trial := 0; ; trial++ {
+			z0, err := sp.baseSampler()
+			if err != nil {
+				return err
+			}
+			if err := sp.read(sp.samplerzRB); err != nil {
+				return err
+			}
+			b := int(sp.samplerzRB[0]) & 1
+			z := float64(b + (2*b-1)*z0)
+			x := math.Pow((z-r), 2) * dss
+			x -= math.Pow(float64(z0), 2) * sp.inv2sigma2
+			e := sp.berexpThreshold(x, ccs)
+			accept, err := sp.berexp(x, ccs)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "sample %d trial %d: bytes=%X z0=%d b=%d x=%.17g threshold=%#016x accept=%t\n",
+				i, trial, rr.seen, z0, b, x, e, accept)
+			rr.seen = rr.seen[:0]
+			if accept {
+				fmt.Fprintf(w, "sample %d: z=%d\n", i, s+int(z))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func TestDumpTrajectory(t *testing.T) {
+	mu := -11.335543982423326
+	sigma := 1.7035823083824078
+	sigmin := 1.2778336969128334
+	n := 64
+
+	var dump bytes.Buffer
+	if err := DumpTrajectory(testSeed, mu, sigma, sigmin, n, &dump); err != nil {
+		t.Fatal(err)
+	}
+
+	var again bytes.Buffer
+	if err := DumpTrajectory(testSeed, mu, sigma, sigmin, n, &again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dump.Bytes(), again.Bytes()) {
+		t.Fatal("trajectory dump is not deterministic")
+	}
+
+	// The dump must follow Samplerz exactly, otherwise it would be useless
+	// for localizing a divergence.
+	sp := newsampler(fromSeedSHAKE(testSeed))
+	sc := bufio.NewScanner(&dump)
+	var i int
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.Contains(line, ": z=") {
+			continue
+		}
+		var idx, z int
+		if _, err := fmt.Sscanf(line, "sample %d: z=%d", &idx, &z); err != nil {
+			t.Fatalf("malformed line %q: %v", line, err)
+		}
+		if want := sp.Samplerz(mu, sigma, sigmin); idx != i || z != want {
+			t.Fatalf("sample %d: dump has sample %d = %d, Samplerz gives %d", i, idx, z, want)
+		}
+		i++
+	}
+	if i != n {
+		t.Fatalf("dump has %d samples, want %d", i, n)
+	}
+}
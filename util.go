@@ -2,13 +2,22 @@ package sampler
 
 import (
 	"bytes"
+	"cmp"
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
+	"math"
+	"os"
+	"time"
 
 	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
 )
 
+// Min returns the smaller of a and b, or b if either is NaN.
+//
+// Deprecated: use the built-in min, or Clamp.
 func Min(a float64, b float64) float64 {
 	if a < b {
 		return a
@@ -16,9 +25,32 @@ func Min(a float64, b float64) float64 {
 	return b
 }
 
+// Clamp returns v limited to the interval [lo, hi], which must not be empty.
+// A NaN v, lo or hi gives NaN, as with the built-in min and max.
+func Clamp[T cmp.Ordered](v, lo, hi T) T {
+	return min(max(v, lo), hi)
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// isSubnormal reports whether f is a subnormal (denormalized) float64.
+func isSubnormal(f float64) bool {
+	return f != 0 && math.Abs(f) < 0x1p-1022
+}
+
+// NewBigNumFromHex parses the 0x-prefixed hexadecimal s. It panics if s is
+// invalid, so that a typo in a table fails at initialization instead of
+// silently giving a zero entry.
 func NewBigNumFromHex(s string) *uint256.Int {
-	bn := new(uint256.Int)
-	bn.SetFromHex(s)
+	bn, err := uint256.FromHex(s)
+	if err != nil {
+		panic(fmt.Sprintf("sampler: invalid hex literal %q: %v", s, err))
+	}
 	return bn
 }
 
@@ -44,7 +76,55 @@ func fromSeedSHAKE(seed []byte) io.Reader {
 	return shake
 }
 
+// domainSeed returns domain || uint64(n) || parts, n in big endian, the seed
+// of one of the SHAKE256 streams derived from a caller's seed.
+func domainSeed(domain string, n uint64, parts ...[]byte) []byte {
+	size := len(domain) + 8
+	for _, p := range parts {
+		size += len(p)
+	}
+	s := make([]byte, 0, size)
+	s = append(s, domain...)
+	s = binary.BigEndian.AppendUint64(s, n)
+	for _, p := range parts {
+		s = append(s, p...)
+	}
+	return s
+}
+
 // Only for testing purposes.
 func bytesReader(b []byte) io.Reader {
 	return bytes.NewReader(b)
 }
+
+// readAtLeast is io.ReadAtLeast, bounded by timeout if it is positive.
+//
+// A bounded read runs in its own goroutine into a private buffer, since a
+// bare io.Reader cannot be interrupted; on timeout that goroutine is abandoned
+// and keeps reading from r until it returns, so the position of r is then
+// unspecified.
+func readAtLeast(r io.Reader, dst []byte, min int, timeout time.Duration) (int, error) {
+	if timeout <= 0 {
+		return io.ReadAtLeast(r, dst, min)
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	buf := make([]byte, len(dst))
+	done := make(chan result, 1)
+	go func() {
+		n, err := io.ReadAtLeast(r, buf, min)
+		done <- result{n, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return copy(dst, buf[:res.n]), res.err
+	case <-timer.C:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
@@ -0,0 +1,60 @@
+package sampler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SamplerzWithWitness returns Samplerz(mu, sigma, sigmin) together with the
+// random bytes it consumed, in order. The witness lets a prover show that z
+// was sampled correctly from committed randomness: SamplerzFromBytes replays
+// it, provided sp has the default table and rejection step. Bytes read ahead
+// by WithReadBuffer but not used are not part of the witness.
+func (sp *Sampler) SamplerzWithWitness(mu, sigma, sigmin float64) (z int, witness []byte) {
+	sp.witness = &witness
+	defer func() { sp.witness = nil }()
+	z = sp.Samplerz(mu, sigma, sigmin)
+	return z, witness
+}
+
+// SamplerzFromBytes returns the sample of Samplerz(mu, sigma, sigmin) drawn
+// from the randomness witness, which must be consumed exactly: an error
+// wrapping ErrRNG is returned if it is too short, and an error if bytes are
+// left over, since the witness then did not produce this sample alone.
+func SamplerzFromBytes(witness []byte, mu, sigma, sigmin float64) (int, error) {
+	r := bytes.NewReader(witness)
+	z, err := newsampler(r).SamplerzErr(mu, sigma, sigmin)
+	if err != nil {
+		return 0, err
+	}
+	if r.Len() != 0 {
+		return 0, fmt.Errorf("sampler: %d unused witness bytes out of %d", r.Len(), len(witness))
+	}
+	return z, nil
+}
+
+// TraceConsumption returns the sample of Samplerz(mu, sigma, sigmin) drawn
+// from b, as SamplerzFromBytes, together with the size of every read the
+// sampler issued, in order: per trial RCDTprecLen bytes for the base
+// sampler, 1 for the sign and 1 to 8 for BerExp. The sizes are those of the
+// draws of an unbuffered sampler with the default options, the layout that
+// the known-answer tests fix, so that a change of the pattern shows up even
+// when the sample does not. It panics as Samplerz, e.g. if b is too short.
+func TraceConsumption(b []byte, mu, sigma, sigmin float64) (sample int, reads []int) {
+	r := &tracingReader{r: bytes.NewReader(b)}
+	sample = newsampler(r).Samplerz(mu, sigma, sigmin)
+	return sample, r.reads
+}
+
+// tracingReader records the sizes of the reads made from it. It is not an
+// io.ByteReader, so that single bytes are read through Read as well.
+type tracingReader struct {
+	r     io.Reader
+	reads []int
+}
+
+func (t *tracingReader) Read(p []byte) (int, error) {
+	t.reads = append(t.reads, len(p))
+	return t.r.Read(p)
+}
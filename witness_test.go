@@ -0,0 +1,80 @@
+package sampler
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSamplerzWithWitness(t *testing.T) {
+	rr := &recordingReader{r: fromSeedSHAKE(testSeed)}
+	sp := newsampler(rr)
+	ref := newsampler(fromSeedSHAKE(testSeed))
+	for i := 0; i < 1000; i++ {
+		mu := float64(i)/3 - 150
+		rr.seen = nil
+		z, witness := sp.SamplerzWithWitness(mu, 1.7, 1.28)
+		if want := ref.Samplerz(mu, 1.7, 1.28); z != want {
+			t.Fatalf("sample %d: got %d, want %d", i, z, want)
+		}
+		if len(witness) != len(rr.seen) {
+			t.Fatalf("sample %d: witness of %d bytes, %d consumed", i, len(witness), len(rr.seen))
+		}
+		got, err := SamplerzFromBytes(witness, mu, 1.7, 1.28)
+		if err != nil || got != z {
+			t.Fatalf("sample %d: replay gives %d, %v, want %d", i, got, err, z)
+		}
+	}
+
+	_, witness := sp.SamplerzWithWitness(0.5, 1.7, 1.28)
+	if _, err := SamplerzFromBytes(witness[:len(witness)-1], 0.5, 1.7, 1.28); !errors.Is(err, ErrRNG) {
+		t.Errorf("short witness: got %v, want ErrRNG", err)
+	}
+	if _, err := SamplerzFromBytes(append(witness, 0), 0.5, 1.7, 1.28); err == nil {
+		t.Error("expected an error for a witness with unused bytes")
+	}
+	// Recording stops with the sample.
+	if z := sp.Samplerz(0.5, 1.7, 1.28); sp.witness != nil {
+		t.Errorf("witness still recorded after sample %d", z)
+	}
+}
+
+func TestTraceConsumption(t *testing.T) {
+	for i, v := range samplerKATs() {
+		octets := decodeHexString(v.Octets)
+		z, reads := TraceConsumption(octets, v.Mu, v.Sigma, v.Sigmin)
+		if z != v.Z {
+			t.Fatalf("KAT %d: got %d, want %d", i, z, v.Z)
+		}
+		_, iterations := newsampler(bytesReader(octets)).SamplerzWithStats(v.Mu, v.Sigma, v.Sigmin)
+
+		// Each trial is a base sample, a sign byte and 1 to 8 BerExp bytes.
+		var total, trials int
+		for k := 0; k < len(reads); trials++ {
+			if reads[k] != int(RCDTprecLen) || k+1 >= len(reads) || reads[k+1] != 1 {
+				t.Fatalf("KAT %d: trial %d starts with reads %v", i, trials, reads[k:min(k+2, len(reads))])
+			}
+			total += int(RCDTprecLen) + 1
+			k += 2
+			var berexp int
+			for ; k < len(reads) && reads[k] == 1; k++ {
+				berexp++
+			}
+			if berexp < 1 || berexp > 8 {
+				t.Fatalf("KAT %d: trial %d draws %d BerExp bytes", i, trials, berexp)
+			}
+			total += berexp
+		}
+		if trials != iterations || total != len(octets) {
+			t.Fatalf("KAT %d: %d trials reading %d bytes, want %d trials reading %d", i, trials, total, iterations, len(octets))
+		}
+	}
+
+	// The first KAT, frozen: a rejected trial, then an accepted one, each
+	// decided on the first BerExp byte.
+	v := samplerKATs()[0]
+	_, reads := TraceConsumption(decodeHexString(v.Octets), v.Mu, v.Sigma, v.Sigmin)
+	if want := []int{9, 1, 1, 9, 1, 1}; !slices.Equal(reads, want) {
+		t.Errorf("reads of the first KAT: got %v, want %v", reads, want)
+	}
+}